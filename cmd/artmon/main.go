@@ -0,0 +1,207 @@
+// Command artmon receives Art-Net like ledctrl and shows live
+// statistics and a coarse preview of the frame in the terminal, so it
+// runs over SSH with no window system.
+//
+// artmon is not an Art-Net node: controllers polling for nodes do not
+// find it, and ArtAddress does not reconfigure it.  It binds the
+// Art-Net port, which ledctrl also binds, so on the same host both
+// must share it, artmon with -shared and ledctrl with
+// -artnet_shared.  Both then receive broadcast Art-Net, but Linux
+// delivers a source's unicast packets to only one of them.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmacd/nerve/pru/artnet"
+)
+
+var (
+	listen   = flag.String("listen", "", "address to receive Art-Net on (default: all)")
+	width    = flag.Int("width", 128, "frame width in pixels")
+	height   = flag.Int("height", 128, "frame height in pixels")
+	universe = flag.Int("universe", int(artnet.DefaultConfig.StartUniverse), "Port-Address of the first universe")
+	channels = flag.Int("channels", artnet.DefaultConfig.ChannelsPerUniverse, "DMX channels used per universe")
+	order    = flag.String("order", "RGB", "channel order of each pixel, of R, G, B and an optional W")
+	interval = flag.Duration("interval", time.Second, "time between updates")
+	columns  = flag.Int("columns", 64, "preview width in characters (0 for none)")
+	color    = flag.Bool("color", true, "preview in ANSI 24-bit color, else in ASCII")
+	shared   = flag.Bool("shared", false, "share the Art-Net port with other receivers on the host, such as ledctrl -artnet_shared")
+)
+
+// ramp shades the ASCII preview, from dark to light.
+const ramp = " .:-=+*#%@"
+
+// key identifies the packets of one universe from one source.
+type key struct {
+	source   string
+	universe uint16
+}
+
+// monitor prints the statistics of a Receiver, with rates since the
+// previous print.
+type monitor struct {
+	recv *artnet.Receiver
+	out  *image.RGBA
+	w    *bufio.Writer
+
+	last    time.Time
+	frames  uint64
+	packets map[key]uint64
+	bytes   map[key]uint64
+}
+
+func (m *monitor) print(now time.Time) {
+	st := m.recv.Stats()
+	secs := now.Sub(m.last).Seconds()
+	rate := func(n, prev uint64) float64 {
+		return float64(n-prev) / secs
+	}
+
+	// Home the cursor and clear the screen.
+	fmt.Fprint(m.w, "\x1b[H\x1b[2J")
+	fmt.Fprintf(m.w, "frames %d (%.1f/s)  incomplete %d  complete %.1f%%  invalid %d  ignored %d\n\n",
+		st.Frames, rate(st.Frames, m.frames), st.Incomplete, 100*st.CompletionRate(), st.Invalid, st.Ignored)
+
+	var keys []key
+	for src, us := range st.Sources {
+		for u := range us {
+			keys = append(keys, key{src, u})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].universe < keys[j].universe
+	})
+
+	fmt.Fprintf(m.w, "%-22s %8s %8s %9s %7s %6s %6s %4s %6s\n",
+		"source", "universe", "pkts/s", "kB/s", "lost", "stale", "dup", "seq", "age")
+	packets, bytes := map[key]uint64{}, map[key]uint64{}
+	for _, k := range keys {
+		us := st.Sources[k.source][k.universe]
+		packets[k], bytes[k] = us.Packets, us.Bytes
+		fmt.Fprintf(m.w, "%-22s %8s %8.1f %9.1f %7d %6d %6d %4d %6s\n",
+			k.source, portAddress(k.universe),
+			rate(us.Packets, m.packets[k]), rate(us.Bytes, m.bytes[k])/1000,
+			us.Lost, us.Stale, us.Duplicates, us.Sequence,
+			now.Sub(us.LastSeen).Round(100*time.Millisecond))
+	}
+	m.last, m.frames, m.packets, m.bytes = now, st.Frames, packets, bytes
+
+	if *columns > 0 {
+		fmt.Fprintln(m.w)
+		if seq := m.recv.Draw(); seq != 0 {
+			m.preview()
+		} else {
+			fmt.Fprintln(m.w, "no complete frame")
+		}
+	}
+	m.w.Flush()
+}
+
+// portAddress formats a Port-Address as Net:Sub-Net:Universe.
+func portAddress(a uint16) string {
+	return fmt.Sprintf("%d:%d:%d", a>>8, a>>4&0xf, a&0xf)
+}
+
+// preview prints the frame reduced to the preview width.  In color,
+// each character shows two pixels, one above the other; in ASCII,
+// characters are about twice as tall as wide, so each shows a pixel
+// of twice the height.
+func (m *monitor) preview() {
+	b := m.out.Bounds()
+	cols := min(*columns, b.Dx())
+	cell := float64(b.Dx()) / float64(cols)
+	rows := int(float64(b.Dy()) / (2 * cell))
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			x0, x1 := int(float64(col)*cell), int(float64(col+1)*cell)
+			y0, y1 := int(float64(2*row)*cell), int(float64(2*row+2)*cell)
+			if !*color {
+				r, g, bl := average(m.out, image.Rect(x0, y0, x1, y1))
+				l := (299*r + 587*g + 114*bl) / 1000
+				m.w.WriteByte(ramp[l*len(ramp)/256])
+				continue
+			}
+			ym := (y0 + y1) / 2
+			tr, tg, tb := average(m.out, image.Rect(x0, y0, x1, ym))
+			br, bg, bb := average(m.out, image.Rect(x0, ym, x1, y1))
+			fmt.Fprintf(m.w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", tr, tg, tb, br, bg, bb)
+		}
+		if *color {
+			m.w.WriteString("\x1b[0m")
+		}
+		m.w.WriteByte('\n')
+	}
+}
+
+// average returns the mean RGB of the pixels of img in r.
+func average(img *image.RGBA, r image.Rectangle) (red, green, blue int) {
+	r = r.Intersect(img.Rect)
+	n := r.Dx() * r.Dy()
+	if n == 0 {
+		return 0, 0, 0
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			red += int(img.Pix[i])
+			green += int(img.Pix[i+1])
+			blue += int(img.Pix[i+2])
+		}
+	}
+	return red / n, green / n, blue / n
+}
+
+func Main() error {
+	flag.Parse()
+
+	if *universe < 0 || *universe >= 1<<15 {
+		return fmt.Errorf("universe %d is not a 15-bit Port-Address", *universe)
+	}
+	cfg := artnet.DefaultConfig
+	cfg.StartUniverse = uint16(*universe)
+	cfg.ChannelsPerUniverse = *channels
+	cfg.Format.Order = strings.ToUpper(*order)
+	cfg.Passive = true
+	cfg.Shared = *shared
+
+	out := image.NewRGBA(image.Rect(0, 0, *width, *height))
+	recv, err := artnet.NewReceiverConfig(*listen, out, cfg)
+	if err != nil {
+		return err
+	}
+	if err := recv.Start(context.Background()); err != nil {
+		return err
+	}
+
+	m := &monitor{
+		recv: recv,
+		out:  out,
+		w:    bufio.NewWriter(os.Stdout),
+		last: time.Now(),
+	}
+	for now := range time.Tick(*interval) {
+		m.print(now)
+	}
+	return nil
+}
+
+func main() {
+	if err := Main(); err != nil {
+		log.Print("artmon: ", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,143 @@
+// Command artrec records the Art-Net frames sent to this host, and
+// replays them to a node with their original timing.
+//
+//	artrec record show.rec
+//	artrec -node 10.0.0.2 -loop -speed 0.5 replay show.rec
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/nerve/pru/artnet"
+)
+
+var (
+	listen    = flag.String("listen", "", "address to record Art-Net packets on (default: all)")
+	node      = flag.String("node", "", "Art-Net node address to replay to (default: the first discovered)")
+	broadcast = flag.String("broadcast", "255.255.255.255", "broadcast address for Art-Net discovery")
+	loop      = flag.Bool("loop", false, "replay the recording until interrupted")
+	speed     = flag.Float64("speed", 1, "replay speed, e.g., 2 for twice as fast")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: artrec [flags] record|replay file\n")
+	flag.PrintDefaults()
+}
+
+// record writes the packets received to a file until interrupted.
+func record(ctx context.Context, name string) error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(*listen), Port: packet.ArtNetPort})
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rec, err := artnet.NewRecorder(file)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("recording to %s, interrupt to stop", name)
+	buf := make([]byte, 1024)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := rec.Record(buf[:n]); err != nil {
+			return err
+		}
+	}
+	if err := rec.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// replay sends a recording to the node, once or until interrupted.
+func replay(ctx context.Context, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	pkts, err := artnet.ReadRecording(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(pkts) == 0 {
+		return fmt.Errorf("%s: empty recording", name)
+	}
+
+	sender := artnet.NewSender(*node)
+	if *node == "" {
+		nodes, err := sender.Discover(ctx, *broadcast)
+		if err != nil {
+			return fmt.Errorf("error discovering Art-Net nodes: %w", err)
+		}
+		if len(nodes) == 0 {
+			return errors.New("no Art-Net nodes found")
+		}
+		log.Println("replaying to", nodes[0])
+		sender.SetDestination(nodes[0].IP.String())
+	}
+
+	log.Printf("replaying %d packets over %v", len(pkts), pkts[len(pkts)-1].At)
+	for {
+		err := sender.Replay(ctx, pkts, *speed)
+		if errors.Is(err, context.Canceled) || (err == nil && !*loop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func Main() error {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch cmd, name := flag.Arg(0), flag.Arg(1); cmd {
+	case "record":
+		return record(ctx, name)
+	case "replay":
+		return replay(ctx, name)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func main() {
+	if err := Main(); err != nil {
+		log.Print("artrec: ", err)
+		os.Exit(1)
+	}
+}
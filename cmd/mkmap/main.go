@@ -1,114 +1,40 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
-	"strings"
-)
 
-const (
-	pinFile = "bbb-pins.csv"
-	mapFile = "fpp-octo.json"
+	"github.com/jmacd/nerve/pru/gpixio"
 )
 
-type gpioNum struct {
-	bank int
-	bit  int
-}
-
-type capePinType struct {
-	Pin  string `json:"pin"`
-	Type string `json:"type"`
-}
-
-type capeOutput struct {
-	Pins map[string]string `json:"pins"`
-}
-
-type cape struct {
-	Name     string `json:"name"`
-	LongName string `json:"longName"`
-	PRU      int    `json:"pru"`
-	Timing   int    `json:"timing"`
-	Controls struct {
-		GPIO  int         `json:"gpio"`
-		Latch capePinType `json:"latch"`
-		OE    capePinType `json:"oe"`
-		Clock capePinType `json:"clock"`
-		Sel0  capePinType `json:"sel0"`
-		Sel1  capePinType `json:"sel1"`
-		Sel2  capePinType `json:"sel2"`
-		Sel3  capePinType `json:"sel3"`
-		Sel4  capePinType `json:"sel4"`
-	} `json:"controls"`
-	Outputs []capeOutput `json:"outputs"`
-}
-
-func ParsePins() (map[string]gpioNum, error) {
-	pin2gpio := map[string]gpioNum{}
+var (
+	capeFile = flag.String("cape", "", "FPP cape descriptor (default: embedded Octoscroller)")
+	pinFile  = flag.String("pins", "", "BeagleBone pin table (default: embedded)")
+)
 
-	f, err := os.Open(pinFile)
-	if err != nil {
-		return nil, fmt.Errorf("open %s: %w", pinFile, err)
-	}
-	pins, err := csv.NewReader(f).ReadAll()
+func ParsePins() (map[string]gpixio.GPIO, error) {
+	f, err := gpixio.OpenFile(*pinFile, gpixio.BBBPins)
 	if err != nil {
-		return nil, fmt.Errorf("read csv %s: %w", pinFile, err)
+		return nil, err
 	}
-	for _, row := range pins {
-		ps := row[0]
-		gs := row[9]
-		if !strings.HasPrefix(gs, "gpio") {
-			continue
-		}
-		pinAdd := 0
-		if strings.HasSuffix(ps, ".1") {
-			ps = ps[:len(ps)-2]
-			// This +50 convention is used in the fpp config file.
-			pinAdd = 50
-		}
-		hdr := ps[:2]
-		pinNum, err := strconv.Atoi(ps[3:])
-		if err != nil {
-			return nil, fmt.Errorf("invalid pin: %s", ps)
-		}
-		pin := fmt.Sprintf("%s-%02d", hdr, pinNum+pinAdd)
-
-		bank := int(gs[4] - '0')
-		if bank < 0 || bank > 3 {
-			return nil, fmt.Errorf("invalid gpio: %s", gs)
-		}
-		bit, err := strconv.Atoi(gs[6:])
-		if err != nil {
-			return nil, fmt.Errorf("invalid gpio: %s", gs)
-		}
-
-		pin2gpio[pin] = gpioNum{
-			bank: bank,
-			bit:  bit,
-		}
-	}
-	return pin2gpio, nil
+	defer f.Close()
+	return gpixio.ParsePins(f)
 }
 
-func ParseCape() (cape, error) {
-	var c cape
-	ccfg, err := os.ReadFile(mapFile)
+func ParseCape() (*gpixio.Cape, error) {
+	f, err := gpixio.OpenFile(*capeFile, gpixio.OctoscrollerCape)
 	if err != nil {
-		return c, err
+		return nil, err
 	}
-
-	if err := json.Unmarshal(ccfg, &c); err != nil {
-		return c, err
-	}
-	return c, nil
+	defer f.Close()
+	return gpixio.ParseCape(f)
 }
 
 func Main() error {
+	flag.Parse()
+
 	p2g, err := ParsePins()
 	if err != nil {
 		return err
@@ -125,7 +51,7 @@ func Main() error {
 				return fmt.Errorf("unknown pin: J%d-%s: %s", i+1, which, pin)
 			}
 
-			fmt.Printf("J%d %s gpio%d/%d\n", i+1, which, gpio.bank, gpio.bit)
+			fmt.Printf("J%d %s gpio%d/%d\n", i+1, which, gpio.Bank, gpio.Bit)
 		}
 	}
 
@@ -135,7 +61,7 @@ func Main() error {
 		for i, output := range c.Outputs {
 			for which, pin := range output.Pins {
 				gpio := p2g[pin]
-				if gpio.bank != bank {
+				if gpio.Bank != bank {
 					continue
 				}
 				var cname string
@@ -148,7 +74,7 @@ func Main() error {
 					cname = "blues"
 				}
 				order := which[1]
-				fmt.Printf("  %s.choose(J%d_%c, f, %d),\n", cname, i+1, order, gpio.bit)
+				fmt.Printf("  %s.choose(J%d_%c, f, %d),\n", cname, i+1, order, gpio.Bit)
 			}
 		}
 		fmt.Printf(")\n")
@@ -168,7 +94,7 @@ func Main() error {
 				add = 2
 			}
 
-			fmt.Printf("  if dp.Gpio%d & (1<<%d) != 0 {\n", gpio.bank, gpio.bit)
+			fmt.Printf("  if dp.Gpio%d & (1<<%d) != 0 {\n", gpio.Bank, gpio.Bit)
 			fmt.Printf("     add4(&img.Pix[j%d%cOff+%d])\n", i+1, which[1], add)
 			fmt.Printf("  }\n")
 		}
@@ -184,7 +110,7 @@ func Main() error {
 			if which[0] == 'b' {
 				value = 1
 			}
-			fmt.Printf("      pixptr->gpv%d.bits.j%d_%s = %d;\n", gpio.bank, i+1, which, value)
+			fmt.Printf("      pixptr->gpv%d.bits.j%d_%s = %d;\n", gpio.Bank, i+1, which, value)
 		}
 	}
 
@@ -203,7 +129,7 @@ func Main() error {
 				"g2": "0 ^ quad",
 				"b2": "1 ^ quad",
 			}[which]
-			fmt.Printf("      pixptr->gpv%d.bits.j%d_%s = %s;\n", gpio.bank, i+1, which, value)
+			fmt.Printf("      pixptr->gpv%d.bits.j%d_%s = %s;\n", gpio.Bank, i+1, which, value)
 		}
 	}
 
@@ -218,10 +144,10 @@ typedef union {
 			for i, output := range c.Outputs {
 				for which, pin := range output.Pins {
 					gpio := p2g[pin]
-					if gpio.bank != bank {
+					if gpio.Bank != bank {
 						continue
 					}
-					if gpio.bit != bit {
+					if gpio.Bit != bit {
 						continue
 					}
 					fmt.Printf("    unsigned j%d_%s : 1; // %d\n", i+1, which, bit)
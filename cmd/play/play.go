@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,8 +16,6 @@ import (
 )
 
 const (
-	ipAddr = "192.168.0.23"
-
 	width  = 20
 	height = 15
 	pixels = width * height
@@ -23,6 +23,14 @@ const (
 	epsilon = 0.00001
 )
 
+var (
+	node      = flag.String("node", "", "Art-Net node address (default: the first discovered)")
+	broadcast = flag.String("broadcast", "255.255.255.255", "broadcast address for Art-Net discovery")
+	order     = flag.String("order", "RGB", "channel order of each pixel, of R, G, B and an optional W")
+	depth     = flag.Int("depth", 1, "bytes per channel, 1 or 2")
+	perUniv   = flag.Int("pixels_per_universe", 0, "pixels sent in each universe (default: as many as fit)")
+)
+
 type (
 	Color = colorful.Color
 
@@ -30,7 +38,27 @@ type (
 )
 
 func main() {
-	sender := artnet.NewSender(ipAddr)
+	flag.Parse()
+
+	sender := artnet.NewSender(*node)
+	sender.Format = artnet.Format{Order: strings.ToUpper(*order), Depth: *depth}
+	sender.PixelsPerUniverse = *perUniv
+	if err := sender.Format.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *node == "" {
+		nodes, err := sender.Discover(context.Background(), *broadcast)
+		if err != nil {
+			log.Fatalf("error discovering Art-Net nodes: %v", err)
+		}
+		if len(nodes) == 0 {
+			log.Fatal("no Art-Net nodes found")
+		}
+		for _, n := range nodes {
+			log.Println("found", n)
+		}
+		sender.SetDestination(nodes[0].IP.String())
+	}
 
 	l, err := xl.Open()
 	if err != nil {
@@ -1,47 +1,21 @@
 module github.com/jmacd/nerve
 
-go 1.18
+go 1.21
 
 require (
-	fyne.io/fyne/v2 v2.3.0
 	github.com/hsluv/hsluv-go v2.0.0+incompatible
 	github.com/jkl1337/go-chromath v0.0.0-20140428033135-240283655afd
-	github.com/jmacd/launchmidi v0.0.0-20221203062954-9a79ac9cf609
+	github.com/jmacd/go-artnet v0.0.0-20220707060336-6bfd9f54a67f
+	github.com/jmacd/launchmidi v0.0.0-20231203073955-ae7df3ce652c
 	github.com/jmacd/nerve/pru v0.0.0-00010101000000-000000000000
 	github.com/lucasb-eyer/go-colorful v1.2.0
 )
 
 require (
-	fyne.io/systray v1.10.1-0.20221115204952-d16a6177e6f1 // indirect
-	github.com/benoitkugler/textlayout v0.3.0 // indirect
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fredbi/uri v0.1.0 // indirect
-	github.com/fsnotify/fsnotify v1.5.4 // indirect
-	github.com/fyne-io/gl-js v0.0.0-20220119005834-d2da28d9ccfe // indirect
-	github.com/fyne-io/glfw-js v0.0.0-20220120001248-ee7290d23504 // indirect
-	github.com/fyne-io/image v0.0.0-20220602074514-4956b0afb3d2 // indirect
-	github.com/go-gl/gl v0.0.0-20211210172815-726fda9656d6 // indirect
-	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20221017161538-93cebf72946b // indirect
-	github.com/go-text/typesetting v0.0.0-20221212183139-1eb938670a1f // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
-	github.com/goki/freetype v0.0.0-20220119013949-7a161fd3728c // indirect
-	github.com/gopherjs/gopherjs v1.17.2 // indirect
-	github.com/jmacd/go-artnet v0.0.0-20220707060336-6bfd9f54a67f // indirect
-	github.com/jsummers/gobmp v0.0.0-20151104160322-e2ba15ffa76e // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/srwiley/oksvg v0.0.0-20220731023508-a61f04f16b76 // indirect
-	github.com/srwiley/rasterx v0.0.0-20210519020934-456a8d69b780 // indirect
-	github.com/stretchr/testify v1.8.0 // indirect
-	github.com/tevino/abool v1.2.0 // indirect
-	github.com/yuin/goldmark v1.4.13 // indirect
 	gitlab.com/gomidi/midi/v2 v2.0.25 // indirect
 	golang.org/x/image v0.6.0 // indirect
-	golang.org/x/mobile v0.0.0-20211207041440-4e6c2922fdee // indirect
 	golang.org/x/net v0.6.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
-	honnef.co/go/js/dom v0.0.0-20210725211120-f030747120f2 // indirect
 )
 
 replace github.com/jmacd/nerve/pru => ./pru
@@ -0,0 +1,188 @@
+package artnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// maxPortAddress is the largest 15-bit Port-Address.
+	maxPortAddress = 1<<15 - 1
+
+	// dmxChannels is the size of a DMX universe.
+	dmxChannels = 512
+)
+
+// Config places the pixels of a frame in DMX universes.  The frame
+// is the channels of every pixel, laid out by Format, in row-major
+// order, starting at StartChannel of universe StartUniverse and
+// continuing through consecutive universes of ChannelsPerUniverse
+// channels.  A pixel may straddle two universes when
+// ChannelsPerUniverse is not a multiple of its channels.
+type Config struct {
+	// StartUniverse is the 15-bit Port-Address of the first
+	// universe, see PortAddress.
+	StartUniverse uint16 `json:"start_universe"`
+
+	// ChannelsPerUniverse is the number of channels used in each
+	// universe, at most 512.
+	ChannelsPerUniverse int `json:"channels_per_universe"`
+
+	// StartChannel is the 0-based channel of the first pixel in
+	// the first universe.
+	StartChannel int `json:"start_channel"`
+
+	// ShortName and LongName identify the node to controllers in
+	// ArtPollReply, at most 17 and 63 bytes.
+	ShortName string `json:"short_name"`
+	LongName  string `json:"long_name"`
+
+	// Format is the layout of the channels of each pixel.
+	Format Format `json:"format"`
+
+	// Width and Height are the size of the frame received, if it
+	// differs from that of the output.  Fit places the frame in
+	// Region of the output, the whole output if empty, scaling it
+	// by FitStretch (the default, if empty), FitLetterbox, FitCrop
+	// or FitNone.
+	Width  int             `json:"width"`
+	Height int             `json:"height"`
+	Fit    string          `json:"fit"`
+	Region image.Rectangle `json:"region"`
+
+	// Merge is how the channels of a universe received from two
+	// sources combine, MergeHTP (the default, if empty) or
+	// MergeLTP.
+	Merge string `json:"merge"`
+
+	// Passive receives without being a node: the Receiver does not
+	// answer ArtPoll, so controllers do not list it, nor obey
+	// ArtAddress.  It suits a monitor.
+	Passive bool `json:"-"`
+
+	// Shared binds the Art-Net port so that other Shared receivers
+	// on the host can bind it as well.  Each receives broadcast
+	// packets, but Linux delivers each source's unicast packets
+	// to only one of them.
+	Shared bool `json:"-"`
+}
+
+// DefaultConfig packs 170 pixels into each universe starting at
+// Port-Address 0, as Sender does.
+var DefaultConfig = Config{
+	StartUniverse:       0,
+	ChannelsPerUniverse: 3 * maxPerPacket,
+	StartChannel:        0,
+	ShortName:           "nerve",
+	LongName:            "nerve LED panels",
+	Merge:               MergeHTP,
+}
+
+// PortAddress combines the Net (7 bits), Sub-Net (4 bits) and
+// Universe (4 bits) of an Art-Net Port-Address.
+func PortAddress(net, subNet, universe int) uint16 {
+	return uint16(net&0x7f)<<8 | uint16(subNet&0xf)<<4 | uint16(universe&0xf)
+}
+
+// Validate checks that the configuration is usable.
+func (c Config) Validate() error {
+	if c.StartUniverse > maxPortAddress {
+		return fmt.Errorf("start universe %d is not a 15-bit Port-Address", c.StartUniverse)
+	}
+	if c.ChannelsPerUniverse < 3 || c.ChannelsPerUniverse > dmxChannels {
+		return fmt.Errorf("channels per universe %d is not in [3, %d]", c.ChannelsPerUniverse, dmxChannels)
+	}
+	if c.StartChannel < 0 || c.StartChannel >= c.ChannelsPerUniverse {
+		return fmt.Errorf("start channel %d is not in [0, %d)", c.StartChannel, c.ChannelsPerUniverse)
+	}
+	if len(c.ShortName) > shortNameLen-1 || len(c.LongName) > longNameLen-1 {
+		return fmt.Errorf("node names are limited to %d and %d bytes", shortNameLen-1, longNameLen-1)
+	}
+	if err := c.Format.Validate(); err != nil {
+		return err
+	}
+	if c.Width < 0 || c.Height < 0 || (c.Width == 0) != (c.Height == 0) {
+		return fmt.Errorf("frame size %dx%d is not positive", c.Width, c.Height)
+	}
+	switch c.Fit {
+	case "", FitStretch, FitLetterbox, FitCrop, FitNone:
+	default:
+		return fmt.Errorf("fit %q is not %q, %q, %q or %q", c.Fit, FitStretch, FitLetterbox, FitCrop, FitNone)
+	}
+	if c.Merge != "" && c.Merge != MergeHTP && c.Merge != MergeLTP {
+		return fmt.Errorf("merge mode %q is not %q or %q", c.Merge, MergeHTP, MergeLTP)
+	}
+	return nil
+}
+
+// LoadConfig reads a Config saved by Save.  Fields missing from the
+// file take their values from DefaultConfig.  A missing file is
+// reported with an error satisfying errors.Is(err, fs.ErrNotExist).
+func LoadConfig(name string) (Config, error) {
+	c := DefaultConfig
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return c, c.Validate()
+}
+
+// Save writes the Config to a file, replacing it atomically.
+func (c Config) Save(name string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Universes returns the number of universes holding a frame of the
+// given number of pixels.
+func (c Config) Universes(pixels int) int {
+	return (c.StartChannel + c.Format.Channels()*pixels + c.ChannelsPerUniverse - 1) / c.ChannelsPerUniverse
+}
+
+// size returns the size of the frame received for output to out.
+func (c Config) size(out image.Rectangle) image.Point {
+	if c.Width == 0 {
+		return out.Size()
+	}
+	return image.Pt(c.Width, c.Height)
+}
+
+// check returns an error if the frame received for output to out
+// does not fit below the largest Port-Address, or its region does not
+// fit in out.
+func (c Config) check(out image.Rectangle) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if !c.Region.Empty() && !c.Region.In(out) {
+		return fmt.Errorf("region %v is outside the frame %v", c.Region, out)
+	}
+	size := c.size(out)
+	pixels := size.X * size.Y
+	if last := int(c.StartUniverse) + c.Universes(pixels) - 1; last > maxPortAddress {
+		return fmt.Errorf("%d pixels from universe %d exceed the largest Port-Address", pixels, c.StartUniverse)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package artnet
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+// dmxHeaderLen is the size of the ArtDmx header, before the data.
+const dmxHeaderLen = 18
+
+// opCode returns the OpCode of an Art-Net packet, decoded in place.
+func opCode(b []byte) (code.OpCode, bool) {
+	if len(b) < 10 || !bytes.Equal(b[:8], packet.ArtNet[:]) {
+		return 0, false
+	}
+	return code.OpCode(binary.LittleEndian.Uint16(b[8:])), true
+}
+
+// dmxHeader decodes an ArtDmx packet in place, returning its 15-bit
+// Port-Address, sequence number and channel data, which refers to b.
+func dmxHeader(b []byte) (addr uint16, seq uint8, data []byte, ok bool) {
+	if len(b) < dmxHeaderLen {
+		return 0, 0, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b[16:]))
+	if n > len(b)-dmxHeaderLen {
+		n = len(b) - dmxHeaderLen
+	}
+	addr = uint16(b[15]&0x7f)<<8 | uint16(b[14])
+	return addr, b[12], b[dmxHeaderLen : dmxHeaderLen+n], true
+}
@@ -0,0 +1,126 @@
+package artnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+// discoverTimeout is how long Discover waits for replies when the
+// context has no deadline, per the Art-Net specification.
+const discoverTimeout = 3 * time.Second
+
+// Node is an Art-Net node that answered Discover.
+type Node struct {
+	IP        net.IP
+	ShortName string
+	LongName  string
+
+	// Universes are the Port-Addresses of the node's outputs, of
+	// which Merging are those merging two sources.
+	Universes []uint16
+	Merging   []uint16
+
+	// Report is the node's description of its status.
+	Report string
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("%s %q universes %v", n.IP, n.ShortName, n.Universes)
+}
+
+// Discover sends an ArtPoll to a broadcast address, such as
+// "255.255.255.255" or the directed broadcast of the LAN, at the
+// Art-Net port unless another is given.  It returns the nodes that
+// answer before the context is done, in the order they answer.
+// Without a deadline, it waits three seconds.
+func (s *Sender) Discover(ctx context.Context, broadcast string) ([]Node, error) {
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(broadcast); err != nil {
+		broadcast = fmt.Sprintf("%s:%d", broadcast, packet.ArtNetPort)
+	}
+	dest, err := net.ResolveUDPAddr("udp", broadcast)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving broadcast udp: %v", err)
+	}
+	poll, err := packet.NewArtPollPacket().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.conn.WriteTo(poll, dest); err != nil {
+		return nil, fmt.Errorf("error writing poll: %v", err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(discoverTimeout)
+	}
+	s.conn.SetReadDeadline(deadline)
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	// Cancellation interrupts the read by moving the deadline.
+	stop := context.AfterFunc(ctx, func() {
+		s.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	var nodes []Node
+	index := map[string]int{}
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nodes, nil
+		}
+		if err != nil {
+			return nodes, fmt.Errorf("error reading poll reply: %v", err)
+		}
+		p, err := packet.Unmarshal(buf[:n])
+		if err != nil || p.GetOpCode() != code.OpPollReply {
+			// The poll itself, or other traffic.
+			continue
+		}
+		reply := p.(*packet.ArtPollReplyPacket)
+
+		ip := net.IP(reply.IPAddress[:])
+		if ip.IsUnspecified() {
+			ip = from.IP
+		}
+		i, ok := index[ip.String()]
+		if !ok {
+			i = len(nodes)
+			index[ip.String()] = i
+			nodes = append(nodes, Node{
+				IP:        append(net.IP(nil), ip.To4()...),
+				ShortName: cString(reply.ShortName[:]),
+				LongName:  cString(reply.LongName[:]),
+			})
+		}
+		node := &nodes[i]
+
+		report := make([]byte, len(reply.NodeReport))
+		for j, c := range reply.NodeReport {
+			report[j] = byte(c)
+		}
+		node.Report = cString(report)
+
+		for j := 0; j < int(reply.NumPorts) && j < portsPerReply; j++ {
+			if !reply.PortTypes[j].Output() {
+				continue
+			}
+			addr := PortAddress(int(reply.NetSwitch), int(reply.SubSwitch), int(reply.SwOut[j]))
+			node.Universes = append(node.Universes, addr)
+			if reply.GoodOutput[j].Merging() {
+				node.Merging = append(node.Merging, addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package artnet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is the layout of the DMX channels of one pixel.
+type Format struct {
+	// Order names the color of each channel, "R", "G", "B" and
+	// optionally "W", e.g., "GRB" or "RGBW".  The default, if
+	// empty, is "RGB".  White is derived from the RGB value as
+	// their least, which is taken from each.
+	Order string `json:"order"`
+
+	// Depth is the bytes per channel, 1 (the default, if zero) or
+	// 2 for 16-bit values, most significant byte first.
+	Depth int `json:"depth"`
+}
+
+// Validate checks that the format is usable.
+func (f Format) Validate() error {
+	order := f.order()
+	for _, c := range "RGB" {
+		if strings.Count(order, string(c)) != 1 {
+			return fmt.Errorf("channel order %q does not name R, G and B once each", f.Order)
+		}
+	}
+	if strings.Count(order, "W") > 1 || len(order) != 3+strings.Count(order, "W") {
+		return fmt.Errorf("channel order %q has other channels than R, G, B and W", f.Order)
+	}
+	if f.Depth < 0 || f.Depth > 2 {
+		return fmt.Errorf("channel depth %d is not 1 or 2 bytes", f.Depth)
+	}
+	return nil
+}
+
+// Channels returns the number of DMX channels per pixel.
+func (f Format) Channels() int {
+	return len(f.order()) * f.depth()
+}
+
+func (f Format) order() string {
+	if f.Order == "" {
+		return "RGB"
+	}
+	return f.Order
+}
+
+func (f Format) depth() int {
+	if f.Depth == 0 {
+		return 1
+	}
+	return f.Depth
+}
+
+// rgb8 reports whether the format is 8-bit RGB, the layout of
+// image.RGBA without alpha.
+func (f Format) rgb8() bool {
+	return f.order() == "RGB" && f.depth() == 1
+}
+
+// encode writes the channels of the RGBA pixel px to ch.
+func (f Format) encode(ch, px []byte) {
+	order, depth := f.order(), f.depth()
+	var w byte
+	if strings.IndexByte(order, 'W') >= 0 {
+		w = min(px[0], px[1], px[2])
+	}
+	for i := 0; i < len(order); i++ {
+		v := w
+		switch order[i] {
+		case 'R':
+			v = px[0] - w
+		case 'G':
+			v = px[1] - w
+		case 'B':
+			v = px[2] - w
+		}
+		// Repeating the byte scales 255 to 65535.
+		for j := 0; j < depth; j++ {
+			ch[i*depth+j] = v
+		}
+	}
+}
+
+// decode writes the RGBA pixel px from the channels ch, adding white
+// to each of RGB.
+func (f Format) decode(px, ch []byte) {
+	order, depth := f.order(), f.depth()
+	var rgbw [4]int
+	for i := 0; i < len(order); i++ {
+		rgbw[strings.IndexByte("RGBW", order[i])] = int(ch[i*depth])
+	}
+	w := rgbw[3]
+	px[0] = byte(min(rgbw[0]+w, 255))
+	px[1] = byte(min(rgbw[1]+w, 255))
+	px[2] = byte(min(rgbw[2]+w, 255))
+}
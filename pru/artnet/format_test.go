@@ -0,0 +1,164 @@
+package artnet
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/rand"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestFormatEncode(t *testing.T) {
+	px := []byte{10, 20, 30, 0}
+	for _, test := range []struct {
+		f    Format
+		want []byte
+	}{
+		{Format{}, []byte{10, 20, 30}},
+		{Format{Order: "GRB"}, []byte{20, 10, 30}},
+		{Format{Order: "RGBW"}, []byte{0, 10, 20, 10}},
+		{Format{Order: "WBGR", Depth: 2}, []byte{10, 10, 20, 20, 10, 10, 0, 0}},
+	} {
+		ch := make([]byte, test.f.Channels())
+		test.f.encode(ch, px)
+		if !bytes.Equal(ch, test.want) {
+			t.Errorf("%+v: channels %v, want %v", test.f, ch, test.want)
+		}
+		got := make([]byte, 4)
+		test.f.decode(got, ch)
+		if !bytes.Equal(got, px) {
+			t.Errorf("%+v: decoded %v", test.f, got)
+		}
+	}
+
+	for _, bad := range []Format{
+		{Order: "RGBX"},
+		{Order: "RRGB"},
+		{Order: "RGBWW"},
+		{Order: "RG"},
+		{Depth: 3},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("%+v: no error", bad)
+		}
+	}
+}
+
+func TestSenderFormat(t *testing.T) {
+	for _, test := range []struct {
+		f           Format
+		perUniverse int
+		universes   int
+	}{
+		{Format{Order: "GRB"}, 0, 4},
+		{Format{Order: "RGBW"}, 0, 4},
+		{Format{Depth: 2}, 0, 7},
+		{Format{Order: "GRBW", Depth: 2}, 50, 11},
+	} {
+		conn, s := listen(t)
+		s.Format = test.f
+		s.PixelsPerUniverse = test.perUniverse
+		src := randomImage(1)
+		if err := s.Send(src); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := DefaultConfig
+		cfg.Format = test.f
+		cfg.ChannelsPerUniverse = test.f.Channels() * (dmxChannels / test.f.Channels())
+		if test.perUniverse != 0 {
+			cfg.ChannelsPerUniverse = test.f.Channels() * test.perUniverse
+		}
+		out := image.NewRGBA(src.Rect)
+		r := newReceiver(nil, out, cfg)
+
+		buf := make([]byte, maxPacketSize)
+		for i := 0; ; i++ {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(buf[:n], artSync) {
+				if i != test.universes {
+					t.Errorf("%+v: %d universes, want %d", test.f, i, test.universes)
+				}
+				break
+			}
+			r.handle(buf[:n], netip.AddrPort{})
+		}
+		if seq := r.Draw(); seq != 1 || string(out.Pix) != string(src.Pix) {
+			t.Errorf("%+v: sequence %d, frame equal %v", test.f, seq, string(out.Pix) == string(src.Pix))
+		}
+	}
+
+	// Pixels must fit in a universe.
+	_, s := listen(t)
+	s.Format = Format{Order: "RGBW"}
+	s.PixelsPerUniverse = 129
+	if err := s.Send(randomImage(1)); err == nil {
+		t.Error("no error sending 516 channels per universe")
+	}
+}
+
+func TestSenderManyUniverses(t *testing.T) {
+	// 128x128 pixels at 32 per universe take 512 universes,
+	// beyond the 256 of Net 0.
+	conn, s := listen(t)
+	s.PixelsPerUniverse = 32
+	src := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	rand.New(rand.NewSource(1)).Read(src.Pix)
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 0
+	}
+
+	cfg := DefaultConfig
+	cfg.ChannelsPerUniverse = 3 * 32
+	out := image.NewRGBA(src.Rect)
+	r := newReceiver(nil, out, cfg)
+
+	// Receive while sending, since the socket buffer holds fewer
+	// than 512 packets.
+	done := make(chan error)
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for u := 0; ; u++ {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				done <- err
+				return
+			}
+			if bytes.Equal(buf[:n], artSync) {
+				if u != 512 {
+					err = fmt.Errorf("%d universes, want 512", u)
+				}
+				done <- err
+				return
+			}
+			if addr, _, _, ok := dmxHeader(buf[:n]); !ok || int(addr) != u {
+				done <- fmt.Errorf("packet %d to Port-Address %d", u, addr)
+				return
+			}
+			r.handle(buf[:n], netip.AddrPort{})
+		}
+	}()
+	s.Interval = 100 * time.Millisecond
+	if err := s.Send(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if r.Draw() != 1 || string(out.Pix) != string(src.Pix) {
+		t.Error("frame differs")
+	}
+
+	// A frame of more universes than Port-Addresses is refused.
+	s.PixelsPerUniverse = 1
+	if err := s.Send(image.NewRGBA(image.Rect(0, 0, 256, 129))); err == nil {
+		t.Error("no error sending 33024 universes")
+	}
+}
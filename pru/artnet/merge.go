@@ -0,0 +1,98 @@
+package artnet
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Merge modes, for Config.Merge.
+const (
+	// MergeHTP takes the highest value of each channel.
+	MergeHTP = "htp"
+
+	// MergeLTP takes the channels of the latest packet.
+	MergeLTP = "ltp"
+)
+
+const (
+	// mergeSources is how many sources the Receiver merges into
+	// one universe.  Packets from more are ignored.
+	mergeSources = 2
+
+	// mergeTimeout is how long a source may be silent before it
+	// stops being merged, per the Art-Net specification.
+	mergeTimeout = 10 * time.Second
+
+	// ArtAddress commands that cancel merging, or set the merge
+	// mode of output port 0 to 3 by adding the port.
+	acCancelMerge = 0x01
+	acMergeLtp0   = 0x10
+	acMergeHtp0   = 0x50
+)
+
+// source is the latest data of one source for one universe.
+type source struct {
+	from netip.AddrPort
+	last time.Time
+	n    int
+	data [dmxChannels]byte
+}
+
+// active reports whether the source has sent recently.
+func (s *source) active(now time.Time) bool {
+	return !s.last.IsZero() && now.Sub(s.last) < mergeTimeout
+}
+
+// port merges the sources of one universe.
+type port struct {
+	src [mergeSources]source
+	out [dmxChannels]byte
+}
+
+// merge records the data of one packet and returns the channels of
+// the universe, merging those of the other source if it is active.
+// It returns false when two other sources are active.
+func (p *port) merge(from netip.AddrPort, data []byte, now time.Time, ltp bool) ([]byte, bool) {
+	var s, other *source
+	switch {
+	case p.src[0].from == from && p.src[0].active(now):
+		s, other = &p.src[0], &p.src[1]
+	case p.src[1].from == from && p.src[1].active(now):
+		s, other = &p.src[1], &p.src[0]
+	case !p.src[0].active(now):
+		s, other = &p.src[0], &p.src[1]
+	case !p.src[1].active(now):
+		s, other = &p.src[1], &p.src[0]
+	default:
+		return nil, false
+	}
+	s.from, s.last = from, now
+	n := copy(s.data[:], data)
+	if n < s.n {
+		clear(s.data[n:s.n])
+	}
+	s.n = n
+
+	if ltp || !other.active(now) {
+		return s.data[:s.n], true
+	}
+	n = max(s.n, other.n)
+	for i := 0; i < n; i++ {
+		p.out[i] = max(s.data[i], other.data[i])
+	}
+	return p.out[:n], true
+}
+
+// merging reports whether the port is merging two sources.
+func (p *port) merging(now time.Time) bool {
+	return p.src[0].active(now) && p.src[1].active(now)
+}
+
+// cancel stops merging sources other than the given one.
+func (p *port) cancel(from netip.AddrPort) {
+	for i := range p.src {
+		if p.src[i].from != from {
+			p.src[i] = source{}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package artnet
+
+import (
+	"image"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+)
+
+func TestReceiverMerge(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	a := netip.MustParseAddrPort("10.0.0.1:6454")
+	b := netip.MustParseAddrPort("10.0.0.2:6454")
+	c := netip.MustParseAddrPort("10.0.0.3:6454")
+	send := func(img *image.RGBA, from netip.AddrPort) {
+		for _, p := range dmxPackets(t, img) {
+			r.handle(p, from)
+		}
+	}
+	expect := func(what string, seq uint64, want *image.RGBA) {
+		t.Helper()
+		if got := r.Draw(); got != seq || string(out.Pix) != string(want.Pix) {
+			t.Errorf("%s: sequence %d, want %d, frame equal %v", what, got, seq, string(out.Pix) == string(want.Pix))
+		}
+	}
+	merging := func() bool {
+		replies := r.pollReplies(net.IPv4(127, 0, 0, 1))
+		p, err := packet.Unmarshal(replies[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.(*packet.ArtPollReplyPacket).GoodOutput[0].Merging()
+	}
+
+	// One source alone.
+	imgA, imgB, imgC := randomImage(1), randomImage(2), randomImage(3)
+	send(imgA, a)
+	expect("one source", 1, imgA)
+	if merging() {
+		t.Error("merging one source")
+	}
+
+	// A second source merges, highest channel first, and
+	// completes the next frame.
+	send(imgB, b)
+	htp := image.NewRGBA(imgA.Rect)
+	for i := range htp.Pix {
+		htp.Pix[i] = max(imgA.Pix[i], imgB.Pix[i])
+	}
+	expect("HTP", 2, htp)
+	if !merging() {
+		t.Error("not merging two sources")
+	}
+
+	// A third is ignored.
+	send(imgC, c)
+	if st := r.Stats(); st.Ignored != 4 || st.Incomplete != 0 {
+		t.Errorf("ignored %d incomplete %d", st.Ignored, st.Incomplete)
+	}
+
+	// In LTP mode, the latest packet wins.
+	r.cfg.Merge = MergeLTP
+	send(imgB, b)
+	expect("LTP", 3, imgB)
+	send(imgA, a)
+	expect("LTP", 4, imgA)
+
+	// Once both time out, the third takes over.
+	now = now.Add(mergeTimeout)
+	send(imgC, c)
+	expect("timeout", 5, imgC)
+	if merging() {
+		t.Error("merging after timeout")
+	}
+
+	// Cancelling keeps only the next source to send.
+	r.cfg.Merge = MergeHTP
+	send(imgA, a)
+	r.cancelMerge = true
+	send(imgB, b)
+	expect("cancel", 7, imgB)
+	if merging() {
+		t.Error("merging after cancel")
+	}
+}
@@ -0,0 +1,213 @@
+package artnet
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+const (
+	// shortNameLen and longNameLen are the sizes of the name
+	// fields of ArtPollReply and ArtAddress, including the NUL.
+	shortNameLen = 18
+	longNameLen  = 64
+
+	// portsPerReply is the number of universes one ArtPollReply
+	// describes.
+	portsPerReply = 4
+
+	// programBit marks the switches of an ArtAddress that are to
+	// be programmed, as opposed to left unchanged.
+	programBit = 0x80
+
+	// rcPowerOk is the NodeReport code for normal operation.
+	rcPowerOk = 0x0001
+)
+
+// SetConfigFile names a file where configuration changes made by
+// ArtAddress are saved, see LoadConfig.  Without one, changes last
+// until the program exits.  This must be called before Start.
+func (r *Receiver) SetConfigFile(name string) {
+	r.configFile = name
+}
+
+// SetRecorder records the ArtDmx and ArtSync packets received, for
+// replay by Sender.Replay.  This must be called before Start.
+func (r *Receiver) SetRecorder(rec *Recorder) {
+	r.recorder = rec
+}
+
+// Config returns the current configuration, which ArtAddress may
+// have changed.
+func (r *Receiver) Config() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// poll answers an ArtPoll.
+func (r *Receiver) poll(from *net.UDPAddr) {
+	for _, b := range r.pollReplies(r.localIP(from)) {
+		if _, err := r.conn.WriteToUDP(b, from); err != nil {
+			fmt.Printf("artnet: poll reply: %v\n", err)
+			return
+		}
+	}
+}
+
+// address applies an ArtAddress, which may rename the node, move its
+// universes or change how they merge, then answers with ArtPollReply.
+// The Net, Sub-Net and first output switch program the Port-Address
+// of the first universe; the rest follow consecutively.  All
+// universes merge alike, so setting the merge mode of any port sets
+// that of every one.
+func (r *Receiver) address(p *packet.ArtAddressPacket, from *net.UDPAddr) {
+	cfg := r.cfg
+	if name := cString(p.ShortName[:]); name != "" {
+		cfg.ShortName = name
+	}
+	if name := cString(p.LongName[:]); name != "" {
+		cfg.LongName = name
+	}
+	addr := cfg.StartUniverse
+	if p.NetSwitch&programBit != 0 {
+		addr = addr&^0x7f00 | uint16(p.NetSwitch&0x7f)<<8
+	}
+	if p.SubSwitch&programBit != 0 {
+		addr = addr&^0xf0 | uint16(p.SubSwitch&0xf)<<4
+	}
+	if p.SwOut[0]&programBit != 0 {
+		addr = addr&^0xf | uint16(p.SwOut[0]&0xf)
+	}
+	cfg.StartUniverse = addr
+
+	switch c := p.Command; {
+	case c == acCancelMerge:
+		r.cancelMerge = true
+	case c >= acMergeLtp0 && c < acMergeLtp0+portsPerReply:
+		cfg.Merge = MergeLTP
+	case c >= acMergeHtp0 && c < acMergeHtp0+portsPerReply:
+		cfg.Merge = MergeHTP
+	}
+
+	switch err := cfg.check(r.in.Rect); {
+	case err != nil:
+		fmt.Printf("artnet: address: %v\n", err)
+	case cfg != r.cfg:
+		if cfg.StartUniverse != r.cfg.StartUniverse {
+			clear(r.ports)
+		}
+		r.mu.Lock()
+		r.cfg = cfg
+		r.mu.Unlock()
+		r.reset()
+
+		if r.configFile != "" {
+			if err := cfg.Save(r.configFile); err != nil {
+				fmt.Printf("artnet: address: %v\n", err)
+			}
+		}
+	}
+	r.poll(from)
+}
+
+// pollReplies returns the ArtPollReply packets describing the node,
+// one per group of up to four universes that share a Net and
+// Sub-Net.
+func (r *Receiver) pollReplies(ip net.IP) [][]byte {
+	cfg := r.cfg
+	r.polls++
+	seq := r.Sequence()
+	now := r.now()
+
+	var replies [][]byte
+	start := int(cfg.StartUniverse)
+	end := start + cfg.Universes(r.pixels)
+	for u := start; u < end; {
+		p := packet.ArtPollReplyPacket{
+			Port:      packet.ArtNetPort,
+			NetSwitch: uint8(u >> 8 & 0x7f),
+			SubSwitch: uint8(u >> 4 & 0xf),
+			Status1:   code.Status1(0).WithPortAddr("net"),
+			Style:     code.StNode,
+			BindIndex: uint8(len(replies) + 1),
+			Status2:   code.Status2(0).WithPort15(true),
+		}
+		copy(p.IPAddress[:], ip.To4())
+		copy(p.BindIP[:], ip.To4())
+		copy(p.Macaddress[:], macAddress(ip))
+		copy(p.ShortName[:shortNameLen-1], cfg.ShortName)
+		copy(p.LongName[:longNameLen-1], cfg.LongName)
+
+		report := fmt.Sprintf("#%04x [%04d] %d frames", rcPowerOk, r.polls%10000, seq)
+		for i := 0; i < len(p.NodeReport)-1 && i < len(report); i++ {
+			p.NodeReport[i] = code.NodeReportCode(report[i])
+		}
+
+		for ; u < end && int(p.NumPorts) < portsPerReply && u>>4 == int(p.NetSwitch)<<4|int(p.SubSwitch); u++ {
+			i := p.NumPorts
+			p.PortTypes[i] = code.PortType(0).WithOutput(true).WithType("Art-Net")
+			p.GoodOutput[i] = code.GoodOutput(0).
+				WithData(seq != 0).
+				WithMerging(r.ports[u-start].merging(now)).
+				WithLTP(cfg.Merge == MergeLTP)
+			p.SwOut[i] = uint8(u & 0xf)
+			p.NumPorts++
+		}
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			fmt.Printf("artnet: poll reply: %v\n", err)
+			return nil
+		}
+		replies = append(replies, b)
+	}
+	return replies
+}
+
+// localIP returns the address of the node as seen from a peer.
+func (r *Receiver) localIP(peer *net.UDPAddr) net.IP {
+	if a, ok := r.conn.LocalAddr().(*net.UDPAddr); ok && !a.IP.IsUnspecified() {
+		return a.IP
+	}
+	// Connecting a UDP socket sends nothing, but chooses the
+	// local address that routes to the peer.
+	conn, err := net.DialUDP("udp", nil, peer)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// macAddress returns the hardware address of the interface with the
+// given IP address, or nil.
+func macAddress(ip net.IP) net.HardwareAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return iface.HardwareAddr
+			}
+		}
+	}
+	return nil
+}
+
+// cString returns the text of a NUL-terminated field.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,151 @@
+package artnet
+
+import (
+	"context"
+	"image"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+// startNode runs a Receiver on a loopback port, saving changes to
+// file if set.
+func startNode(t *testing.T, pixels int, cfg Config, file string) (*Receiver, *net.UDPAddr) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReceiver(conn, image.NewRGBA(image.Rect(0, 0, pixels, 1)), cfg)
+	r.SetConfigFile(file)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		conn.Close()
+	})
+	return r, conn.LocalAddr().(*net.UDPAddr)
+}
+
+func testSender() *Sender {
+	return &Sender{srcStr: "127.0.0.1:0"}
+}
+
+func discover(t *testing.T, s *Sender, addr *net.UDPAddr) []Node {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	nodes, err := s.Discover(ctx, addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+func TestDiscover(t *testing.T) {
+	// 6 universes starting at 0x012e span two Sub-Nets, so
+	// take two replies.
+	cfg := DefaultConfig
+	cfg.StartUniverse = PortAddress(1, 2, 14)
+	_, addr := startNode(t, 6*maxPerPacket, cfg, "")
+
+	nodes := discover(t, testSender(), addr)
+	if len(nodes) != 1 {
+		t.Fatalf("found %d nodes", len(nodes))
+	}
+	n := nodes[0]
+	if !n.IP.Equal(addr.IP) || n.ShortName != cfg.ShortName || n.LongName != cfg.LongName {
+		t.Errorf("node %v %q", n, n.LongName)
+	}
+	want := []uint16{0x12e, 0x12f, 0x130, 0x131, 0x132, 0x133}
+	if len(n.Universes) != len(want) {
+		t.Fatalf("universes %v", n.Universes)
+	}
+	for i := range want {
+		if n.Universes[i] != want[i] {
+			t.Fatalf("universes %v", n.Universes)
+		}
+	}
+	if n.Report == "" {
+		t.Error("no report")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "artnet.json")
+	r, addr := startNode(t, 2*maxPerPacket, DefaultConfig, file)
+
+	p := packet.ArtAddressPacket{
+		Header:    packet.Header{OpCode: code.OpAddress},
+		NetSwitch: programBit | 3,
+		SubSwitch: 0x7f, // unchanged
+		SwOut:     [4]uint8{programBit | 5},
+		Command:   acMergeLtp0 + 1,
+	}
+	copy(p.ShortName[:], "stage left")
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := testSender()
+	if err := s.open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.conn.WriteTo(b, addr); err != nil {
+		t.Fatal(err)
+	}
+	nodes := discover(t, s, addr)
+
+	// Both the reply to ArtAddress and to ArtPoll describe
+	// the new configuration.
+	if len(nodes) != 1 || nodes[0].ShortName != "stage left" || nodes[0].Universes[0] != PortAddress(3, 0, 5) {
+		t.Fatalf("nodes %v", nodes)
+	}
+
+	want := DefaultConfig
+	want.ShortName = "stage left"
+	want.StartUniverse = PortAddress(3, 0, 5)
+	want.Merge = MergeLTP
+	if got := r.Config(); got != want {
+		t.Errorf("config %+v", got)
+	}
+	saved, err := LoadConfig(file)
+	if err != nil || saved != want {
+		t.Errorf("saved %+v %v", saved, err)
+	}
+}
+
+func TestPassive(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Passive = true
+	r, addr := startNode(t, 2*maxPerPacket, cfg, "")
+
+	p := packet.ArtAddressPacket{
+		Header:    packet.Header{OpCode: code.OpAddress},
+		NetSwitch: programBit | 3,
+	}
+	copy(p.ShortName[:], "stage left")
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := testSender()
+	if err := s.open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.conn.WriteTo(b, addr); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := discover(t, s, addr); len(nodes) != 0 {
+		t.Errorf("nodes %v", nodes)
+	}
+	if got := r.Config(); got != cfg {
+		t.Errorf("config %+v", got)
+	}
+}
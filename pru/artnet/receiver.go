@@ -2,74 +2,172 @@ package artnet
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"net"
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/jmacd/go-artnet/packet"
 	"github.com/jmacd/go-artnet/packet/code"
+	"github.com/jmacd/nerve/pru/frame"
 )
 
 const (
 	receiverQueueLen = 1000
 	maxPacketSize    = 1024
 	maxPerPacket     = 170
+
+	// syncTimeout is how long after the last ArtSync the Receiver
+	// stops waiting for one, per the Art-Net specification.
+	syncTimeout = 4 * time.Second
 )
 
 type Receiver struct {
 	conn *net.UDPConn
-	out  *image.RGBA
 	in   *image.RGBA
-	cpy  *image.RGBA
 	wg   sync.WaitGroup
 
-	lsu uint8
-	off uint64
+	// cfg places the frame in universes, of which got marks those
+	// received for the frame in progress, and by which source, and
+	// missing counts the rest.  ArtAddress changes cfg, saving it
+	// in configFile if set.
+	cfg        Config
+	configFile string
+	pixels     int
+	got        []bool
+	gotFrom    []netip.AddrPort
+	missing    int
+
+	// recorder, if set, records packets as they arrive.
+	recorder *Recorder
+
+	// scale, if set, receives frames of another size and draws
+	// them into the output.
+	scale *scaler
+
+	// raw, if set, receives the channels of frames in other than
+	// 8-bit RGB, to be decoded when complete.
+	raw []byte
+
+	// ports merges the sources of each universe.  ArtAddress may
+	// set cancelMerge, to stop merging at the next ArtDmx.
+	ports       []port
+	cancelMerge bool
+
+	// polls counts ArtPollReply packets, for the NodeReport.
+	polls int
+
+	// While ArtSync packets arrive, a complete frame is held until
+	// the next one.  lastSync is when the last arrived, and
+	// pending is set while held is waiting.  As Art-Net 4
+	// requires, only ArtSync from the address of the last ArtDmx
+	// accepted, dmxFrom, counts.
+	held     *image.RGBA
+	pending  bool
+	lastSync time.Time
+	dmxFrom  netip.Addr
+	now      func() time.Time
+
+	// mu protects cfg, which the decoder changes on ArtAddress,
+	// and the statistics, with those of each source by universe,
+	// last expired at lastExpire.
+	mu         sync.Mutex
+	stats      ReceiveStats
+	sources    map[netip.AddrPort]map[uint16]*UniverseStats
+	lastExpire time.Time
+
+	// The decoder fills in without locking, then publishes it to
+	// the Buffer (by way of held, when synchronized).
+	*frame.Buffer
 }
 
+// NewReceiver returns a Receiver of frames in the DefaultConfig.
 func NewReceiver(hostIP string, out *image.RGBA) (*Receiver, error) {
-	src := fmt.Sprintf("%s:%d", hostIP, packet.ArtNetPort)
-	localAddr, _ := net.ResolveUDPAddr("udp", src)
+	return NewReceiverConfig(hostIP, out, DefaultConfig)
+}
 
-	conn, err := net.ListenUDP("udp", localAddr)
+// NewReceiverConfig returns a Receiver of frames the size of out,
+// placed in universes by cfg.
+func NewReceiverConfig(hostIP string, out *image.RGBA, cfg Config) (*Receiver, error) {
+	if err := cfg.check(out.Rect); err != nil {
+		return nil, err
+	}
+	src := fmt.Sprintf("%s:%d", hostIP, packet.ArtNetPort)
+	var lc net.ListenConfig
+	if cfg.Shared {
+		lc.Control = reusePort
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp", src)
 	if err != nil {
 		fmt.Printf("error opening udp: %s\n", err)
 		return nil, err
 	}
-	return &Receiver{
-		conn: conn,
-		out:  out,
-		cpy:  image.NewRGBA(out.Bounds()),
-		in:   image.NewRGBA(out.Bounds()),
-	}, nil
+	return newReceiver(conn.(*net.UDPConn), out, cfg), nil
+}
+
+func newReceiver(conn *net.UDPConn, out *image.RGBA, cfg Config) *Receiver {
+	size := cfg.size(out.Rect)
+	pixels := size.X * size.Y
+	r := &Receiver{
+		conn:    conn,
+		in:      image.NewRGBA(out.Bounds()),
+		held:    image.NewRGBA(out.Bounds()),
+		now:     time.Now,
+		cfg:     cfg,
+		pixels:  pixels,
+		got:     make([]bool, cfg.Universes(pixels)),
+		gotFrom: make([]netip.AddrPort, cfg.Universes(pixels)),
+		ports:   make([]port, cfg.Universes(pixels)),
+		sources: map[netip.AddrPort]map[uint16]*UniverseStats{},
+		scale:   newScaler(size, out.Rect, cfg),
+		Buffer:  frame.NewBuffer(out),
+	}
+	if !cfg.Format.rgb8() {
+		r.raw = make([]byte, cfg.Format.Channels()*pixels)
+	}
+	r.reset()
+	return r
+}
+
+// bufPool holds the packet buffers passed from the reader to the
+// decoder, which returns each when done with it.
+var bufPool = sync.Pool{
+	New: func() any { return new([maxPacketSize]byte) },
+}
+
+// datagram is a packet, the first n bytes of buf, and its source.
+type datagram struct {
+	buf  *[maxPacketSize]byte
+	n    int
+	from netip.AddrPort
 }
 
 func (r *Receiver) Start(ctx context.Context) error {
-	recvCh := make(chan []byte, receiverQueueLen)
+	recvCh := make(chan datagram, receiverQueueLen)
 	r.wg.Add(2)
 
 	go func() {
 		defer r.wg.Done()
-		buf := make([]byte, maxPacketSize)
 		for {
-			n, _, err := r.conn.ReadFromUDP(buf) // first packet you read will be your own
+			buf := bufPool.Get().(*[maxPacketSize]byte)
+			n, from, err := r.conn.ReadFromUDPAddrPort(buf[:]) // first packet you read will be your own
 			if err != nil {
+				bufPool.Put(buf)
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				fmt.Printf("error reading packet: %s\n", err)
 				continue
-
 			}
-			// fmt.Printf("packet received from %v, read %d bytes\n", addr.IP, n)
-
-			// if addr.IP.Equal(localAddr.IP) {
-			// 	// skip messages from myself
-			// 	continue
-			// }
+			// IPv4 sources arrive mapped on a dual-stack socket.
+			from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
 			select {
 			case <-ctx.Done():
 				return
-			case recvCh <- buf[:n]:
-				buf = make([]byte, maxPacketSize)
+			case recvCh <- datagram{buf, n, from}:
 			}
 		}
 	}()
@@ -80,54 +178,15 @@ func (r *Receiver) Start(ctx context.Context) error {
 			select {
 			case <-ctx.Done():
 				return
-			case b := <-recvCh:
-				p, err := packet.Unmarshal(b)
-				if err != nil {
-					fmt.Printf("error unmarshalling packet: %s\n", err)
-					continue
-				}
-				switch p.GetOpCode() {
-				case code.OpDMX:
-					dmx := p.(*packet.ArtDMXPacket)
-					off := uint64(0)
-					switch dmx.SubUni {
-					case 0:
-						//fmt.Println("At zero", r.lsu)
-						off = 0
-						r.lsu = 0
-						r.off = 0
-					case r.lsu + 1:
-						off = r.off
-						r.lsu++
-						//fmt.Println("LSU++", r.lsu)
-					default:
-						fmt.Println("artnet: dmx reset", dmx.SubUni, dmx.Length, r.off, r.lsu)
-						off = 0
-						r.off = 0
-						r.lsu = dmx.SubUni
+			case d := <-recvCh:
+				if r.recorder != nil {
+					if err := r.recorder.Record(d.buf[:d.n]); err != nil {
+						fmt.Printf("artnet: record: %v\n", err)
+						r.recorder = nil
 					}
-
-					for i := uint64(0); i*3+2 < uint64(dmx.Length); i++ {
-						o := (off + i) * 4
-						if o+2 < uint64(len(r.in.Pix)) {
-							r.in.Pix[o+0] = dmx.Data[i*3+0]
-							r.in.Pix[o+1] = dmx.Data[i*3+1]
-							r.in.Pix[o+2] = dmx.Data[i*3+2]
-							r.off += 1
-						} else {
-							break
-						}
-					}
-
-					if int(r.off*4) == len(r.in.Pix) {
-						copy(r.cpy.Pix, r.in.Pix)
-						//fmt.Println("FRAME", r.lsu)
-					} else {
-						//fmt.Println("NOTDONE", r.off*4, len(r.in.Pix))
-					}
-				default:
-					fmt.Printf("artnet: %v %#v\n", p.GetOpCode(), p)
 				}
+				r.handle(d.buf[:d.n], d.from)
+				bufPool.Put(d.buf)
 			}
 		}
 	}()
@@ -135,8 +194,161 @@ func (r *Receiver) Start(ctx context.Context) error {
 	return nil
 }
 
-func (r *Receiver) Draw() error {
-	// @@ TODO no synchronization here
-	copy(r.out.Pix, r.cpy.Pix)
-	return nil
+// handle decodes one packet, answering the sender if it asks.  ArtDmx
+// and ArtSync, which arrive many times per frame, are decoded in place
+// without allocating.
+func (r *Receiver) handle(b []byte, from netip.AddrPort) {
+	op, ok := opCode(b)
+	switch {
+	case !ok:
+		r.count(func(st *ReceiveStats) { st.Invalid++ })
+		return
+	case op == code.OpDMX:
+		if addr, seq, data, ok := dmxHeader(b); ok {
+			r.dmx(addr, seq, data, from)
+			return
+		}
+	case op == code.OpSync:
+		r.sync(from)
+		return
+	}
+
+	p, err := packet.Unmarshal(b)
+	if err != nil {
+		r.count(func(st *ReceiveStats) { st.Invalid++ })
+		return
+	}
+	switch op := p.GetOpCode(); {
+	case r.cfg.Passive && (op == code.OpPoll || op == code.OpAddress):
+		// Not a node.
+	case op == code.OpPoll:
+		r.poll(net.UDPAddrFromAddrPort(from))
+	case op == code.OpAddress:
+		r.address(p.(*packet.ArtAddressPacket), net.UDPAddrFromAddrPort(from))
+	case op == code.OpPollReply:
+		// Another node answering a poll.
+	default:
+		fmt.Printf("artnet: %v %#v\n", p.GetOpCode(), p)
+	}
+}
+
+// dmx places the channels of one universe in the frame, by its
+// Port-Address, merging those of two sources.  A universe that
+// arrives twice from one source before the frame completes means a
+// packet was lost, and the frame starts over.  Packets that arrive
+// after a later one from the same source are dropped, as are those
+// of universes outside the frame, which have no statistics.
+func (r *Receiver) dmx(addr uint16, seq uint8, data []byte, from netip.AddrPort) {
+	u := int(addr) - int(r.cfg.StartUniverse)
+	if u < 0 || u >= len(r.got) {
+		return
+	}
+	if !r.sequence(from, addr, seq, len(data)) {
+		return
+	}
+	now := r.now()
+	if r.cancelMerge {
+		for i := range r.ports {
+			r.ports[i].cancel(from)
+		}
+		r.cancelMerge = false
+	}
+	data, ok := r.ports[u].merge(from, data, now, r.cfg.Merge == MergeLTP)
+	if !ok {
+		r.count(func(st *ReceiveStats) { st.Ignored++ })
+		return
+	}
+	r.dmxFrom = from.Addr()
+	if r.got[u] && r.gotFrom[u] == from {
+		r.count(func(st *ReceiveStats) { st.Incomplete++ })
+		r.reset()
+	}
+
+	// Frame channel k holds universe channel 0, which may be
+	// before the frame (k < 0).
+	cpu := r.cfg.ChannelsPerUniverse
+	if len(data) > cpu {
+		data = data[:cpu]
+	}
+	switch k := u*cpu - r.cfg.StartChannel; {
+	case r.raw != nil:
+		rawChannels(r.raw, k, cpu, data)
+	case r.scale != nil:
+		frame.Channels(r.scale.src.Pix, k, cpu, data)
+	default:
+		frame.Channels(r.in.Pix, k, cpu, data)
+	}
+
+	// Another source's copy of the universe is merged, but
+	// counts once toward the frame.
+	if r.got[u] {
+		return
+	}
+	r.got[u] = true
+	r.gotFrom[u] = from
+	r.missing--
+
+	if r.missing == 0 {
+		r.complete()
+		r.reset()
+	}
+}
+
+// complete publishes the frame in r.in, or holds it for an ArtSync
+// if one has arrived recently.
+func (r *Receiver) complete() {
+	r.count(func(st *ReceiveStats) { st.Frames++ })
+	if r.raw != nil {
+		pix := r.in.Pix
+		if r.scale != nil {
+			pix = r.scale.src.Pix
+		}
+		n := r.cfg.Format.Channels()
+		for i := 0; i < len(r.raw)/n; i++ {
+			r.cfg.Format.decode(pix[4*i:], r.raw[n*i:])
+		}
+	}
+	if r.scale != nil {
+		r.scale.draw(r.in)
+	}
+	if !r.lastSync.IsZero() && r.now().Sub(r.lastSync) < syncTimeout {
+		r.in, r.held = r.held, r.in
+		r.pending = true
+		return
+	}
+	r.in = r.Publish(r.in)
+}
+
+// sync publishes the held frame, unless the ArtSync is from another
+// address than the ArtDmx.
+func (r *Receiver) sync(from netip.AddrPort) {
+	if from.Addr() != r.dmxFrom {
+		r.count(func(st *ReceiveStats) { st.Ignored++ })
+		return
+	}
+	r.lastSync = r.now()
+	if r.pending {
+		r.held = r.Publish(r.held)
+		r.pending = false
+	}
+}
+
+// reset starts a new frame.
+func (r *Receiver) reset() {
+	for i := range r.got {
+		r.got[i] = false
+	}
+	r.missing = len(r.got)
+}
+
+// rawChannels copies the channels of one DMX universe, width wide, to
+// the channels of a frame, as frame.Channels does.
+func rawChannels(raw []byte, k, width int, data []byte) {
+	for ch := max(0, -k); ch < width && k+ch < len(raw); ch++ {
+		var v byte
+		if ch < len(data) {
+			v = data[ch]
+		}
+		raw[k+ch] = v
+	}
 }
@@ -0,0 +1,483 @@
+package artnet
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"net"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+)
+
+// dmxPackets encodes img as the Sender does.
+func dmxPackets(t *testing.T, img *image.RGBA) (pkts [][]byte) {
+	t.Helper()
+	var dmx packet.ArtDMXPacket
+	pixels := img.Rect.Dx() * img.Rect.Dy()
+	for p := 0; p < pixels; p += maxPerPacket {
+		for i := 0; i < maxPerPacket && p+i < pixels; i++ {
+			copy(dmx.Data[i*3:i*3+3], img.Pix[4*(p+i):])
+		}
+		b, err := dmx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, b)
+		dmx.SubUni++
+	}
+	return pkts
+}
+
+func randomImage(seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0
+	}
+	return img
+}
+
+func TestReceiverNext(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	ctx := context.Background()
+
+	src := randomImage(1)
+	pkts := dmxPackets(t, src)
+
+	// A partial frame is not delivered.
+	for _, b := range pkts[:len(pkts)-1] {
+		r.handle(b, netip.AddrPort{})
+	}
+	if seq := r.Sequence(); seq != 0 {
+		t.Fatalf("partial frame: sequence %d", seq)
+	}
+
+	done := make(chan uint64)
+	go func() {
+		seq, err := r.Next(ctx, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- seq
+	}()
+
+	r.handle(pkts[len(pkts)-1], netip.AddrPort{})
+	if seq := <-done; seq != 1 {
+		t.Errorf("sequence %d, want 1", seq)
+	}
+	if string(out.Pix) != string(src.Pix) {
+		t.Error("frame differs")
+	}
+	if seq := <-r.Frames(); seq != 1 {
+		t.Errorf("Frames: %d, want 1", seq)
+	}
+
+	// Next waits for a newer frame, until cancelled.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Next(cctx, 1); err == nil {
+		t.Error("Next returned without a new frame")
+	}
+}
+
+func TestReceiverFramesKeepsLatest(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+
+	var last *image.RGBA
+	for i := int64(1); i <= 3; i++ {
+		last = randomImage(i)
+		for _, b := range dmxPackets(t, last) {
+			r.handle(b, netip.AddrPort{})
+		}
+	}
+
+	if seq := <-r.Frames(); seq != 3 {
+		t.Errorf("Frames: %d, want 3", seq)
+	}
+	select {
+	case seq := <-r.Frames():
+		t.Errorf("Frames: extra %d", seq)
+	default:
+	}
+	if seq := r.Draw(); seq != 3 || string(out.Pix) != string(last.Pix) {
+		t.Errorf("Draw: sequence %d", seq)
+	}
+}
+
+// TestReceiverNoTearing draws while frames arrive; every drawn frame
+// must be one of the frames sent.
+func TestReceiverNoTearing(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+
+	var frames []string
+	var pkts [][][]byte
+	for i := int64(1); i <= 4; i++ {
+		img := randomImage(i)
+		frames = append(frames, string(img.Pix))
+		pkts = append(pkts, dmxPackets(t, img))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			for _, b := range pkts[i%len(pkts)] {
+				r.handle(b, netip.AddrPort{})
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	var seq uint64
+	for n := 0; n < 200; n++ {
+		var err error
+		if seq, err = r.Next(ctx, seq); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, f := range frames {
+			found = found || f == string(out.Pix)
+		}
+		if !found {
+			t.Fatalf("frame %d is torn", seq)
+		}
+	}
+}
+
+// configPackets places img in universes by cfg, as a console would.
+func configPackets(t *testing.T, img *image.RGBA, cfg Config) (pkts [][]byte) {
+	t.Helper()
+	var channels []byte
+	channels = append(channels, make([]byte, cfg.StartChannel)...)
+	for i := 0; i < len(img.Pix); i += 4 {
+		channels = append(channels, img.Pix[i:i+3]...)
+	}
+	for u := 0; len(channels) > 0; u++ {
+		addr := int(cfg.StartUniverse) + u
+		dmx := packet.ArtDMXPacket{
+			SubUni: uint8(addr),
+			Net:    uint8(addr >> 8),
+		}
+		n := copy(dmx.Data[:cfg.ChannelsPerUniverse], channels)
+		channels = channels[n:]
+		b, err := dmx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, b)
+	}
+	return pkts
+}
+
+func TestReceiverUniverses(t *testing.T) {
+	cfg := Config{
+		StartUniverse:       PortAddress(1, 15, 14),
+		ChannelsPerUniverse: 512,
+		StartChannel:        7,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	src := randomImage(2)
+	pkts := configPackets(t, src, cfg)
+	if len(pkts) != cfg.Universes(32*16) || len(pkts) != 4 {
+		t.Fatalf("%d universes", len(pkts))
+	}
+
+	out := image.NewRGBA(src.Rect)
+	r := newReceiver(nil, out, cfg)
+
+	// Universes in any order, with others interleaved.
+	other := configPackets(t, randomImage(3), Config{StartUniverse: cfg.StartUniverse + 4, ChannelsPerUniverse: 510})
+	for _, i := range []int{2, 0, 3} {
+		r.handle(pkts[i], netip.AddrPort{})
+		r.handle(other[0], netip.AddrPort{})
+	}
+	if r.Sequence() != 0 {
+		t.Fatal("frame completed early")
+	}
+	r.handle(pkts[1], netip.AddrPort{})
+
+	if seq := r.Draw(); seq != 1 || string(out.Pix) != string(src.Pix) {
+		t.Errorf("sequence %d, frame equal %v", seq, string(out.Pix) == string(src.Pix))
+	}
+
+	// A repeated universe starts the frame over.
+	for _, i := range []int{0, 1, 2, 0, 1, 2} {
+		r.handle(pkts[i], netip.AddrPort{})
+	}
+	if r.Sequence() != 1 {
+		t.Error("incomplete frame delivered")
+	}
+	r.handle(pkts[3], netip.AddrPort{})
+	if r.Sequence() != 2 {
+		t.Error("frame not delivered")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, bad := range []Config{
+		{StartUniverse: 1 << 15, ChannelsPerUniverse: 510},
+		{ChannelsPerUniverse: 513},
+		{ChannelsPerUniverse: 0},
+		{ChannelsPerUniverse: 510, StartChannel: 510},
+		{ChannelsPerUniverse: 510, Merge: "max"},
+		{ChannelsPerUniverse: 510, Width: 64},
+		{ChannelsPerUniverse: 510, Fit: "zoom"},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("%+v: no error", bad)
+		}
+	}
+	if err := (Config{StartUniverse: maxPortAddress, ChannelsPerUniverse: 510}).check(image.Rect(0, 0, 171, 1)); err == nil {
+		t.Error("frame beyond the last Port-Address")
+	}
+	if got := PortAddress(0x7f, 0xf, 0xf); got != maxPortAddress {
+		t.Errorf("PortAddress %#x", got)
+	}
+}
+
+func TestReceiverSync(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	frame := func(seed int64) *image.RGBA {
+		img := randomImage(seed)
+		for _, b := range dmxPackets(t, img) {
+			r.handle(b, netip.AddrPort{})
+		}
+		return img
+	}
+
+	// Before any ArtSync, frames are delivered when complete.
+	frame(1)
+	if r.Sequence() != 1 {
+		t.Fatal("unsynchronized frame not delivered")
+	}
+	r.handle(artSync, netip.AddrPort{})
+
+	// Then, complete frames wait for the next ArtSync, and
+	// the latest complete frame wins.
+	frame(2)
+	img := frame(3)
+	if r.Sequence() != 1 {
+		t.Fatal("frame delivered before ArtSync")
+	}
+	r.handle(artSync, netip.AddrPort{})
+	if seq := r.Draw(); seq != 2 || string(out.Pix) != string(img.Pix) {
+		t.Fatalf("synchronized frame: sequence %d", seq)
+	}
+
+	// An ArtSync without a new frame delivers nothing.
+	r.handle(artSync, netip.AddrPort{})
+	if r.Sequence() != 2 {
+		t.Error("ArtSync without a frame")
+	}
+
+	// Without ArtSync for a while, frames are delivered as before.
+	now = now.Add(syncTimeout)
+	img = frame(4)
+	if seq := r.Draw(); seq != 3 || string(out.Pix) != string(img.Pix) {
+		t.Errorf("after timeout: sequence %d", seq)
+	}
+}
+
+func TestReceiverSyncSource(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	console := netip.MustParseAddrPort("10.0.0.1:6454")
+	other := netip.MustParseAddrPort("10.0.0.2:6454")
+
+	frame := func(seed int64) {
+		for _, b := range dmxPackets(t, randomImage(seed)) {
+			r.handle(b, console)
+		}
+	}
+	frame(1)
+	r.handle(artSync, console)
+
+	// ArtSync from another address than the ArtDmx is ignored,
+	// while the port may differ.
+	img := randomImage(2)
+	frame(2)
+	r.handle(artSync, other)
+	if r.Sequence() != 1 {
+		t.Fatal("frame released by another address")
+	}
+	r.handle(artSync, netip.AddrPortFrom(console.Addr(), 6455))
+	if seq := r.Draw(); seq != 2 || string(out.Pix) != string(img.Pix) {
+		t.Fatalf("sequence %d after ArtSync from the sender", seq)
+	}
+	if st := r.Stats(); st.Ignored != 1 {
+		t.Errorf("%d ignored", st.Ignored)
+	}
+}
+
+func TestSenderSync(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := &Sender{
+		destStr: conn.LocalAddr().String(),
+		srcStr:  "127.0.0.1:0",
+	}
+	src := randomImage(5)
+	if err := s.Send(src); err != nil {
+		t.Fatal(err)
+	}
+
+	out := image.NewRGBA(src.Rect)
+	r := newReceiver(nil, out, DefaultConfig)
+	buf := make([]byte, maxPacketSize)
+	for i := 0; i < 5; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.handle(buf[:n], netip.AddrPort{})
+	}
+	if string(buf[:len(artSync)]) != string(artSync) {
+		t.Error("last packet is not ArtSync")
+	}
+	if seq := r.Draw(); seq != 1 || string(out.Pix) != string(src.Pix) {
+		t.Errorf("sequence %d", seq)
+	}
+}
+
+// panelFrame returns the packets of a 128x128 frame, 97 universes,
+// and a function that numbers them for the next frame.
+func panelFrame(tb testing.TB) (out *image.RGBA, pkts [][]byte, next func()) {
+	out = image.NewRGBA(image.Rect(0, 0, 128, 128))
+	src := image.NewRGBA(out.Rect)
+	rand.New(rand.NewSource(1)).Read(src.Pix)
+
+	var dmx packet.ArtDMXPacket
+	for p := 0; p < 128*128; p += maxPerPacket {
+		for i := 0; i < maxPerPacket && p+i < 128*128; i++ {
+			copy(dmx.Data[i*3:i*3+3], src.Pix[4*(p+i):])
+		}
+		b, err := dmx.MarshalBinary()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		pkts = append(pkts, b)
+		dmx.SubUni++
+		if dmx.SubUni == 0 {
+			dmx.Net++
+		}
+	}
+	pkts = append(pkts, artSync)
+
+	var seq uint8
+	return out, pkts, func() {
+		if seq++; seq == 0 {
+			seq++
+		}
+		for _, b := range pkts[:len(pkts)-1] {
+			b[12] = seq
+		}
+	}
+}
+
+func TestReceiverAllocs(t *testing.T) {
+	out, pkts, next := panelFrame(t)
+	r := newReceiver(nil, out, DefaultConfig)
+	from := netip.MustParseAddrPort("10.0.0.1:6454")
+
+	frame := func() {
+		next()
+		for _, b := range pkts {
+			r.handle(b, from)
+		}
+	}
+	frame() // The first frame creates the statistics.
+	if n := testing.AllocsPerRun(100, frame); n != 0 {
+		t.Errorf("%v allocations per frame", n)
+	}
+	if seq := r.Sequence(); seq != 102 {
+		t.Errorf("sequence %d, want 102", seq)
+	}
+}
+
+func BenchmarkReceiverHandle(b *testing.B) {
+	out, pkts, next := panelFrame(b)
+	r := newReceiver(nil, out, DefaultConfig)
+	from := netip.MustParseAddrPort("10.0.0.1:6454")
+	frame := func() {
+		next()
+		for _, p := range pkts {
+			r.handle(p, from)
+		}
+	}
+	frame()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(out.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame()
+	}
+}
+
+// BenchmarkReceiverLoopback measures the whole receive path, from the
+// socket to the complete frame.
+func BenchmarkReceiverLoopback(b *testing.B) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	out, pkts, next := panelFrame(b)
+	r := newReceiver(conn, out, DefaultConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		r.wg.Wait()
+	}()
+	if err := r.Start(ctx); err != nil {
+		b.Fatal(err)
+	}
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+
+	timeout := time.NewTimer(time.Second)
+	frame := func() {
+		next()
+		for _, p := range pkts {
+			if _, err := client.Write(p); err != nil {
+				b.Fatal(err)
+			}
+		}
+		timeout.Reset(time.Second)
+		select {
+		case <-r.Frames():
+		case <-timeout.C:
+			b.Fatal("frame not received")
+		}
+	}
+	frame()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(out.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame()
+	}
+}
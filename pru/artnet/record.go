@@ -0,0 +1,162 @@
+package artnet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+// recordMagic begins a recording, with the version of its format.
+var recordMagic = []byte("nerve-artnet-rec\x00\x01")
+
+// RecordedPacket is an Art-Net packet and when it arrived, from the
+// start of the recording.
+type RecordedPacket struct {
+	At   time.Duration
+	Data []byte
+}
+
+// Recorder writes the ArtDmx and ArtSync packets it is given to a
+// file, with their arrival times.  Each record is the time in
+// nanoseconds as 8 bytes, the length of the packet as 2, and the
+// packet, big-endian.  A Recorder may be used by several goroutines.
+type Recorder struct {
+	mu        sync.Mutex
+	w         *bufio.Writer
+	start     time.Time
+	lastFlush time.Time
+	now       func() time.Time
+	err       error
+}
+
+// NewRecorder returns a Recorder to w.  Packets are buffered, and
+// written at least every second while recording and by Flush.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	if _, err := w.Write(recordMagic); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: bufio.NewWriter(w), now: time.Now}, nil
+}
+
+// Record writes a packet, if it is ArtDmx or ArtSync, timed from the
+// first.  After an error, it writes no more and returns the error.
+func (r *Recorder) Record(b []byte) error {
+	if op, ok := opCode(b); !ok || (op != code.OpDMX && op != code.OpSync) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	now := r.now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	var hdr [10]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(now.Sub(r.start)))
+	binary.BigEndian.PutUint16(hdr[8:], uint16(len(b)))
+	if _, r.err = r.w.Write(hdr[:]); r.err == nil {
+		_, r.err = r.w.Write(b)
+	}
+	if r.err == nil && now.Sub(r.lastFlush) >= time.Second {
+		r.err = r.w.Flush()
+		r.lastFlush = now
+	}
+	return r.err
+}
+
+// Flush writes any buffered packets.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// ReadRecording reads the packets written by a Recorder.  A recording
+// cut short, as when the recorder was killed, ends at its last whole
+// packet.
+func ReadRecording(rd io.Reader) ([]RecordedPacket, error) {
+	br := bufio.NewReader(rd)
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, recordMagic) {
+		return nil, errors.New("not an Art-Net recording")
+	}
+	var pkts []RecordedPacket
+	var hdr [10]byte
+	for {
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return pkts, nil
+			}
+			return pkts, err
+		}
+		p := RecordedPacket{
+			At:   time.Duration(binary.BigEndian.Uint64(hdr[:])),
+			Data: make([]byte, binary.BigEndian.Uint16(hdr[8:])),
+		}
+		if _, err := io.ReadFull(br, p.Data); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return pkts, nil
+			}
+			return pkts, err
+		}
+		pkts = append(pkts, p)
+	}
+}
+
+// Replay sends recorded packets with their original timing, divided
+// by speed, so that 2 plays twice as fast.  The Sender numbers the
+// ArtDmx packets that were numbered, so that receivers see no jump
+// when a recording is replayed again.  Replay returns when the packets
+// are sent or the context is done.
+func (s *Sender) Replay(ctx context.Context, pkts []RecordedPacket, speed float64) error {
+	if speed <= 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return fmt.Errorf("replay speed %v is not positive", speed)
+	}
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	var b [maxPacketSize]byte
+	start := time.Now()
+	for _, p := range pkts {
+		if wait := time.Until(start.Add(time.Duration(float64(p.At) / speed))); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data := b[:copy(b[:], p.Data)]
+		if op, _ := opCode(data); op == code.OpDMX {
+			if addr, seq, _, ok := dmxHeader(data); ok && seq != 0 {
+				data[12] = s.nextSeq(int(addr))
+			}
+		}
+		if err := s.write([][]byte{data}, s.dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
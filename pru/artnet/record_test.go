@@ -0,0 +1,119 @@
+package artnet
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+)
+
+// recordFrames records frames of randomImage with ArtSync, at the
+// given interval, and an ArtPoll, which is not recorded.
+func recordFrames(t *testing.T, frames int, interval time.Duration) []byte {
+	t.Helper()
+	var file bytes.Buffer
+	rec, err := NewRecorder(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	rec.now = func() time.Time { return now }
+
+	poll, err := packet.NewArtPollPacket().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f := 0; f < frames; f++ {
+		for _, b := range dmxPackets(t, randomImage(int64(f))) {
+			b[12] = uint8(100 + f)
+			if err := rec.Record(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec.Record(poll)
+		rec.Record(artSync)
+		now = now.Add(interval)
+	}
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+func TestRecording(t *testing.T) {
+	file := recordFrames(t, 3, 40*time.Millisecond)
+	pkts, err := ReadRecording(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkts) != 3*5 {
+		t.Fatalf("%d packets", len(pkts))
+	}
+	for i, p := range pkts {
+		if want := time.Duration(i/5) * 40 * time.Millisecond; p.At != want {
+			t.Errorf("packet %d at %v, want %v", i, p.At, want)
+		}
+	}
+	if !bytes.Equal(pkts[4].Data, artSync) {
+		t.Error("fifth packet is not ArtSync")
+	}
+
+	// A recording cut short ends at the last whole packet.
+	pkts, err = ReadRecording(bytes.NewReader(file[:len(file)-100]))
+	if err != nil || len(pkts) != 3*5-2 {
+		t.Errorf("%d packets, %v", len(pkts), err)
+	}
+
+	if _, err := ReadRecording(bytes.NewReader([]byte("Art-Net\x00"))); err == nil {
+		t.Error("no error reading other data")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	pkts, err := ReadRecording(bytes.NewReader(recordFrames(t, 3, 100*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, s := listen(t)
+
+	// Twice, at ten times the speed.
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := s.Replay(context.Background(), pkts, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 35*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("replay took %v", d)
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	buf := make([]byte, maxPacketSize)
+	for i := 0; i < 2*len(pkts); i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.handle(buf[:n], netip.AddrPort{})
+	}
+
+	// Renumbered, no packets are dropped.
+	if seq := r.Draw(); seq != 6 || string(out.Pix) != string(randomImage(2).Pix) {
+		t.Errorf("sequence %d", seq)
+	}
+	if st := r.Stats().Sources[""][0]; st.Sequence != 6 || st.Stale+st.Duplicates+st.Lost != 0 {
+		t.Errorf("universe 0 stats %+v", st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Replay(ctx, pkts, 1); err != context.Canceled {
+		t.Errorf("cancelled replay: %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package artnet
+
+import (
+	"errors"
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("artnet: a shared port is not supported on this platform")
+}
@@ -0,0 +1,82 @@
+package artnet
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit modes, for Config.Fit, place a received frame of another size
+// in its region of the output.
+const (
+	// FitStretch scales the frame to the region, changing its
+	// aspect ratio.
+	FitStretch = "stretch"
+
+	// FitLetterbox scales the frame to fit within the region,
+	// leaving black bars.
+	FitLetterbox = "letterbox"
+
+	// FitCrop scales the frame to cover the region, cropping its
+	// edges.
+	FitCrop = "crop"
+
+	// FitNone centers the frame unscaled, cropping its edges or
+	// leaving black bars.
+	FitNone = "none"
+)
+
+// scaler draws received frames into a region of the output.
+type scaler struct {
+	src  *image.RGBA
+	clip image.Rectangle
+
+	// at is where src is drawn, which may extend past clip.
+	at image.Rectangle
+}
+
+// newScaler returns a scaler of frames of the given size into out, as
+// cfg places them, or nil if they need no scaling.
+func newScaler(size image.Point, out image.Rectangle, cfg Config) *scaler {
+	region := cfg.Region
+	if region.Empty() {
+		region = out
+	}
+	if region == out && size == out.Size() {
+		return nil
+	}
+
+	rw, rh := region.Dx(), region.Dy()
+	w, h := rw, rh
+	switch cfg.Fit {
+	case FitNone:
+		w, h = size.X, size.Y
+	case FitLetterbox, FitCrop:
+		// Letterbox scales by the lesser ratio of the sizes,
+		// crop by the greater.
+		byWidth := rw*size.Y < rh*size.X
+		if byWidth == (cfg.Fit == FitLetterbox) {
+			h = size.Y * rw / size.X
+		} else {
+			w = size.X * rh / size.Y
+		}
+	}
+	at := image.Rect(0, 0, w, h).Add(region.Min).Add(image.Pt((rw-w)/2, (rh-h)/2))
+
+	return &scaler{
+		src:  image.NewRGBA(image.Rectangle{Max: size}),
+		clip: region,
+		at:   at,
+	}
+}
+
+// draw draws the received frame into dst, leaving the rest black.
+func (s *scaler) draw(dst *image.RGBA) {
+	clear(dst.Pix)
+	region := dst.SubImage(s.clip).(*image.RGBA)
+	if s.at.Size() == s.src.Rect.Size() {
+		draw.Copy(region, s.at.Min, s.src, s.src.Rect, draw.Src, nil)
+		return
+	}
+	draw.ApproxBiLinear.Scale(region, s.at, s.src, s.src.Rect, draw.Src, nil)
+}
@@ -0,0 +1,85 @@
+package artnet
+
+import (
+	"image"
+	"image/color"
+	"net/netip"
+	"testing"
+)
+
+func TestReceiverScale(t *testing.T) {
+	// A solid 4x2 frame, which scales to the same color.
+	solid := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := 0; i < len(solid.Pix); i += 4 {
+		copy(solid.Pix[i:], []byte{200, 100, 50})
+	}
+	red := color.RGBA{200, 100, 50, 0}
+
+	for _, test := range []struct {
+		fit    string
+		region image.Rectangle
+
+		// The frame covers want of the 8x8 output.
+		want image.Rectangle
+	}{
+		{"", image.Rectangle{}, image.Rect(0, 0, 8, 8)},
+		{FitStretch, image.Rect(0, 0, 4, 4), image.Rect(0, 0, 4, 4)},
+		{FitLetterbox, image.Rectangle{}, image.Rect(0, 2, 8, 6)},
+		{FitLetterbox, image.Rect(0, 0, 2, 8), image.Rect(0, 3, 2, 4)},
+		{FitCrop, image.Rect(4, 0, 8, 8), image.Rect(4, 0, 8, 8)},
+		{FitNone, image.Rectangle{}, image.Rect(2, 3, 6, 5)},
+		{FitNone, image.Rect(0, 0, 2, 2), image.Rect(0, 0, 2, 2)},
+	} {
+		cfg := DefaultConfig
+		cfg.Width, cfg.Height = 4, 2
+		cfg.Fit, cfg.Region = test.fit, test.region
+
+		out := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		if err := cfg.check(out.Rect); err != nil {
+			t.Fatal(err)
+		}
+		r := newReceiver(nil, out, cfg)
+		for _, b := range configPackets(t, solid, cfg) {
+			r.handle(b, netip.AddrPort{})
+		}
+		if seq := r.Draw(); seq != 1 {
+			t.Fatalf("%s %v: sequence %d", test.fit, test.region, seq)
+		}
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				want := color.RGBA{}
+				if image.Pt(x, y).In(test.want) {
+					want = red
+				}
+				if got := out.RGBAAt(x, y); got != want {
+					t.Fatalf("%s %v: pixel %d,%d is %v, want %v", test.fit, test.region, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	// Unscaled pixels are copied exactly.
+	cfg := DefaultConfig
+	cfg.Width, cfg.Height = 32, 16
+	cfg.Region = image.Rect(16, 8, 48, 24)
+	src := randomImage(1)
+	out := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	r := newReceiver(nil, out, cfg)
+	for _, b := range configPackets(t, src, cfg) {
+		r.handle(b, netip.AddrPort{})
+	}
+	r.Draw()
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if got, want := out.RGBAAt(x+16, y+8), src.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	// The region must fit in the output.
+	cfg.Region = image.Rect(48, 0, 80, 16)
+	if err := cfg.check(out.Rect); err == nil {
+		t.Error("region outside the output")
+	}
+}
@@ -1,32 +1,97 @@
 package artnet
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"log"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
 	"github.com/lucasb-eyer/go-colorful"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// DefaultBurst is the number of packets written at once when
+	// the Sender's Burst is not set.
+	DefaultBurst = 4
+
+	// paceFraction is the part of the frame interval that packets
+	// are spread over, leaving the rest for the sender's own
+	// jitter.
+	paceFraction = 0.75
 )
 
 type (
 	Sender struct {
+		// Interval is the time between frames.  When set, Send
+		// spreads the packets of a frame over most of it, so
+		// that receivers with small socket buffers see no
+		// bursts, and returns when the last is written.
+		Interval time.Duration
+
+		// Burst is the number of packets written together, in
+		// one system call where supported.
+		Burst int
+
+		// Format is the layout of the channels of each pixel,
+		// and PixelsPerUniverse the number of pixels sent in
+		// each universe, by default as many as fit.
+		Format            Format
+		PixelsPerUniverse int
+
 		destStr string
 		srcStr  string
 
-		dest *net.UDPAddr
-		conn *net.UDPConn
+		dest  *net.UDPAddr
+		conn  *net.UDPConn
+		batch *ipv4.PacketConn
+
+		// seq is the last sequence number of each universe.
+		seq []uint8
+
+		pkts [][]byte
+		msgs []ipv4.Message
+
+		mu    sync.Mutex
+		stats map[string]*Stats
 
 		lastLog time.Time
 
 		packet.ArtDMXPacket
 	}
 
+	// Stats counts the packets sent to one destination.
+	Stats struct {
+		Packets uint64
+		Bytes   uint64
+		Errors  uint64
+
+		// LastError is the most recent error, at LastErrorTime.
+		LastError     error
+		LastErrorTime time.Time
+	}
+
 	Color = colorful.Color
 )
 
+// artSync is the ArtSync packet, which tells receivers to output the
+// universes sent before it.  It is the same every time.
+var artSync = func() []byte {
+	p := packet.ArtSyncPacket{
+		Header: packet.Header{OpCode: code.OpSync},
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}()
+
 func NewSender(ipAddr string) *Sender {
 	return &Sender{
 		destStr: fmt.Sprintf("%s:%d", ipAddr, packet.ArtNetPort),
@@ -46,54 +111,191 @@ func (s *Sender) Send(buffer *image.RGBA) error {
 	return err
 }
 
-func (s *Sender) send(buffer *image.RGBA) error {
-	if s.conn == nil {
+// SetDestination changes the node that frames are sent to, e.g., to
+// one found by Discover.
+func (s *Sender) SetDestination(ipAddr string) {
+	s.destStr = fmt.Sprintf("%s:%d", ipAddr, packet.ArtNetPort)
+	s.dest = nil
+}
+
+// open creates the connection, if needed.
+func (s *Sender) open() error {
+	if s.conn != nil {
+		return nil
+	}
+	localAddr, _ := net.ResolveUDPAddr("udp", s.srcStr)
+	conn, err := net.ListenUDP("udp", localAddr)
+	if err != nil {
+		return fmt.Errorf("error resolving artnet udp: %v", err)
+	}
+	s.conn = conn
+	s.batch = ipv4.NewPacketConn(conn)
+	return nil
+}
+
+// Stats returns the statistics of each destination, by address.
+func (s *Sender) Stats() map[string]Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]Stats, len(s.stats))
+	for addr, st := range s.stats {
+		m[addr] = *st
+	}
+	return m
+}
+
+// count adds packets sent to a destination, and any error.
+func (s *Sender) count(dest net.Addr, pkts [][]byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		s.stats = map[string]*Stats{}
+	}
+	st := s.stats[dest.String()]
+	if st == nil {
+		st = &Stats{}
+		s.stats[dest.String()] = st
+	}
+	for _, b := range pkts {
+		st.Packets++
+		st.Bytes += uint64(len(b))
+	}
+	if err != nil {
+		st.Errors++
+		st.LastError = err
+		st.LastErrorTime = time.Now()
+	}
+}
+
+// nextSeq returns the sequence number for a universe, counting from
+// 1 to 255, since 0 means none.
+func (s *Sender) nextSeq(universe int) uint8 {
+	for len(s.seq) <= universe {
+		s.seq = append(s.seq, 0)
+	}
+	q := s.seq[universe] + 1
+	if q == 0 {
+		q = 1
+	}
+	s.seq[universe] = q
+	return q
+}
+
+// resolve opens the connection and resolves the destination, if
+// needed.
+func (s *Sender) resolve() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	if s.dest == nil {
 		node, err := net.ResolveUDPAddr("udp", s.destStr)
 		if err != nil {
 			return fmt.Errorf("error resolving local udp: %v", err)
 		}
-		localAddr, _ := net.ResolveUDPAddr("udp", s.srcStr)
-		conn, err := net.ListenUDP("udp", localAddr)
-		if err != nil {
-			return fmt.Errorf("error resolving artnet udp: %v", err)
-		}
 		s.dest = node
-		s.conn = conn
+	}
+	return nil
+}
+
+func (s *Sender) send(buffer *image.RGBA) error {
+	if err := s.resolve(); err != nil {
+		return err
 	}
 
-	data := s.ArtDMXPacket.Data[:]
-	s.ArtDMXPacket.SubUni = 0
+	if err := s.Format.Validate(); err != nil {
+		return err
+	}
+	stride := s.Format.Channels()
+	perUniverse := s.PixelsPerUniverse
+	if perUniverse <= 0 {
+		perUniverse = dmxChannels / stride
+	}
+	if perUniverse*stride > dmxChannels {
+		return fmt.Errorf("%d pixels of %d channels exceed a universe", perUniverse, stride)
+	}
+
+	// Universes are numbered by 15-bit Port-Address, the Net in
+	// the high byte.
 	pixels := buffer.Rect.Dx() * buffer.Rect.Dy()
-	for p := 0; p < pixels; {
+	if universes := (pixels + perUniverse - 1) / perUniverse; universes > maxPortAddress+1 {
+		return fmt.Errorf("%d pixels need %d universes, more than the %d Port-Addresses", pixels, universes, maxPortAddress+1)
+	}
 
-		num := maxPerPacket
+	s.pkts = s.pkts[:0]
+	data := s.ArtDMXPacket.Data[:]
+	for p, u := 0, 0; p < pixels; u++ {
+
+		num := perUniverse
 		if pixels-p < num {
 			num = pixels - p
 		}
 		for i := 0; i < num; i++ {
-			pi := 4 * (p + i)
-			data[i*3+0] = buffer.Pix[pi+0]
-			data[i*3+1] = buffer.Pix[pi+1]
-			data[i*3+2] = buffer.Pix[pi+2]
+			s.Format.encode(data[i*stride:], buffer.Pix[4*(p+i):])
 		}
-		s.ArtDMXPacket.Length = uint16(num * 3)
+		s.ArtDMXPacket.Length = uint16(num * stride)
+		s.ArtDMXPacket.SubUni = uint8(u)
+		s.ArtDMXPacket.Net = uint8(u >> 8)
+		s.ArtDMXPacket.Sequence = s.nextSeq(u)
 
 		b, _ := s.ArtDMXPacket.MarshalBinary()
 
-		//fmt.Println("Pkt", len(b), "w", num)
 		if len(b) > maxPacketSize {
 			panic(fmt.Sprint("wrong size", len(b)))
 		}
+		s.pkts = append(s.pkts, b)
+		p += num
+	}
+
+	// Receivers that have seen an ArtSync hold the universes
+	// until the next one, so the frame appears all at once.
+	s.pkts = append(s.pkts, artSync)
 
-		_, err := s.conn.WriteTo(b, s.dest)
+	burst := s.Burst
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+	bursts := (len(s.pkts) + burst - 1) / burst
+	spread := time.Duration(float64(s.Interval) * paceFraction)
+	start := time.Now()
+
+	for i := 0; i < bursts; i++ {
+		if s.Interval > 0 {
+			if wait := time.Until(start.Add(spread * time.Duration(i) / time.Duration(bursts))); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		end := (i + 1) * burst
+		if end > len(s.pkts) {
+			end = len(s.pkts)
+		}
+		if err := s.write(s.pkts[i*burst:end], s.dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends packets to a destination, together where supported.
+// The connection stays open after errors, which are usually
+// transient, unless it was closed.
+func (s *Sender) write(pkts [][]byte, dest *net.UDPAddr) error {
+	s.msgs = s.msgs[:0]
+	for _, b := range pkts {
+		s.msgs = append(s.msgs, ipv4.Message{Buffers: [][]byte{b}, Addr: dest})
+	}
+	for sent := 0; sent < len(s.msgs); {
+		n, err := s.batch.WriteBatch(s.msgs[sent:], 0)
+		if n < 0 {
+			n = 0
+		}
+		s.count(dest, pkts[sent:sent+n], err)
 		if err != nil {
-			s.conn.Close()
-			s.conn = nil
-			s.dest = nil
+			if errors.Is(err, net.ErrClosed) {
+				s.conn = nil
+			}
 			return fmt.Errorf("error writing packet: %v", err)
 		}
-		s.ArtDMXPacket.SubUni++
-		p += num
+		sent += n
 	}
 	return nil
 }
@@ -0,0 +1,106 @@
+package artnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jmacd/go-artnet/packet"
+	"github.com/jmacd/go-artnet/packet/code"
+)
+
+// listen returns a loopback connection and a Sender to it.
+func listen(t *testing.T) (*net.UDPConn, *Sender) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, &Sender{
+		destStr: conn.LocalAddr().String(),
+		srcStr:  "127.0.0.1:0",
+	}
+}
+
+func TestSenderSequence(t *testing.T) {
+	conn, s := listen(t)
+	s.seq = []uint8{254}
+
+	buf := make([]byte, maxPacketSize)
+	for frame := 0; frame < 3; frame++ {
+		if err := s.Send(randomImage(int64(frame))); err != nil {
+			t.Fatal(err)
+		}
+		for u := 0; u < 4; u++ {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := packet.Unmarshal(buf[:n])
+			if err != nil || p.GetOpCode() != code.OpDMX {
+				t.Fatalf("packet %v %v", p, err)
+			}
+			dmx := p.(*packet.ArtDMXPacket)
+
+			// Universe 0 wraps from 255 to 1, skipping 0.
+			want := uint8(frame + 1)
+			if u == 0 {
+				want = []uint8{255, 1, 2}[frame]
+			}
+			if int(dmx.SubUni) != u || dmx.Sequence != want {
+				t.Errorf("frame %d universe %d: sequence %d, want %d", frame, dmx.SubUni, dmx.Sequence, want)
+			}
+		}
+		conn.ReadFromUDP(buf) // ArtSync
+	}
+
+	// ArtDmx packets are 18 bytes of header and a full universe.
+	st := s.Stats()[conn.LocalAddr().String()]
+	if st.Packets != 15 || st.Bytes != 3*(4*(18+512)+uint64(len(artSync))) || st.Errors != 0 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestSenderPacing(t *testing.T) {
+	_, s := listen(t)
+	s.Interval = 100 * time.Millisecond
+	s.Burst = 1
+
+	// Five packets in five bursts, the last 4/5 of 75% of the
+	// interval after the first.
+	start := time.Now()
+	if err := s.Send(randomImage(1)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 60*time.Millisecond || d > s.Interval {
+		t.Errorf("paced send took %v", d)
+	}
+
+	s.Interval = 0
+	start = time.Now()
+	if err := s.Send(randomImage(1)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("unpaced send took %v", d)
+	}
+}
+
+func TestSenderErrors(t *testing.T) {
+	// Port 0 cannot be sent to.
+	s := &Sender{destStr: "127.0.0.1:0", srcStr: "127.0.0.1:0"}
+	for i := 0; i < 2; i++ {
+		if err := s.Send(randomImage(1)); err == nil {
+			t.Fatal("no error")
+		}
+	}
+	st := s.Stats()["127.0.0.1:0"]
+	if st.Errors != 2 || st.LastError == nil || st.LastErrorTime.IsZero() {
+		t.Errorf("stats %+v", st)
+	}
+	if s.conn == nil {
+		t.Error("connection closed after a write error")
+	}
+}
@@ -0,0 +1,156 @@
+package artnet
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	// seqWindow is how far back a sequence number may be and
+	// still be taken as out of order.  Further back, the source
+	// restarted.
+	seqWindow = 20
+
+	// maxSources limits the sources with statistics, as a flood
+	// of spoofed addresses could otherwise exhaust memory.
+	// Packets from more are used but not counted.
+	maxSources = 64
+)
+
+// UniverseStats counts the ArtDmx packets from one source for one
+// universe.
+type UniverseStats struct {
+	Packets uint64
+	Bytes   uint64
+
+	// Duplicates and Stale count packets dropped for repeating or
+	// preceding the last sequence number, and Lost counts the
+	// sequence numbers skipped.  Sources that don't number their
+	// packets count none.
+	Duplicates uint64
+	Stale      uint64
+	Lost       uint64
+
+	// Sequence is the last sequence number, at LastSeen.
+	Sequence uint8
+	LastSeen time.Time
+}
+
+// ReceiveStats describes what a Receiver has received.
+type ReceiveStats struct {
+	// Frames counts the complete frames, and Incomplete those
+	// abandoned because a universe arrived twice before the rest.
+	Frames     uint64
+	Incomplete uint64
+
+	// Invalid counts packets that could not be decoded, and
+	// Ignored the ArtDmx packets from a third source of a universe
+	// already merging two and the ArtSync packets from another
+	// address than the last ArtDmx.
+	Invalid uint64
+	Ignored uint64
+
+	// Sources holds the statistics of each source address, by
+	// universe Port-Address.  Universes not heard from for as long
+	// as merging allows, 10 seconds, are forgotten.
+	Sources map[string]map[uint16]UniverseStats
+}
+
+// CompletionRate returns the fraction of frames begun that completed.
+func (s ReceiveStats) CompletionRate() float64 {
+	if s.Frames+s.Incomplete == 0 {
+		return 0
+	}
+	return float64(s.Frames) / float64(s.Frames+s.Incomplete)
+}
+
+// Stats returns what the Receiver has received so far.
+func (r *Receiver) Stats() ReceiveStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.stats
+	st.Sources = make(map[string]map[uint16]UniverseStats, len(r.sources))
+	for from, src := range r.sources {
+		m := make(map[uint16]UniverseStats, len(src))
+		for u, us := range src {
+			m[u] = *us
+		}
+		var key string
+		if from.IsValid() {
+			key = from.String()
+		}
+		st.Sources[key] = m
+	}
+	return st
+}
+
+// count updates the statistics of the Receiver.
+func (r *Receiver) count(f func(st *ReceiveStats)) {
+	r.mu.Lock()
+	f(&r.stats)
+	r.mu.Unlock()
+}
+
+// sequence counts an ArtDmx packet and reports whether to use it,
+// which is not if it repeats or precedes the last from its source.
+func (r *Receiver) sequence(from netip.AddrPort, addr uint16, seq uint8, length int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.lastExpire) >= mergeTimeout {
+		r.expire(now)
+	}
+	src := r.sources[from]
+	if src == nil {
+		if len(r.sources) >= maxSources {
+			return true
+		}
+		src = map[uint16]*UniverseStats{}
+		r.sources[from] = src
+	}
+	us := src[addr]
+	if us == nil {
+		us = &UniverseStats{}
+		src[addr] = us
+	}
+	us.Packets++
+	us.Bytes += uint64(length)
+	us.LastSeen = now
+
+	if seq != 0 && us.Sequence != 0 {
+		// Sequence numbers count from 1 to 255, skipping 0.
+		d := (int(seq) - int(us.Sequence) + 255) % 255
+		if d > 127 {
+			d -= 255
+		}
+		switch {
+		case d == 0:
+			us.Duplicates++
+			return false
+		case d < 0 && d > -seqWindow:
+			us.Stale++
+			return false
+		case d > 1:
+			us.Lost += uint64(d - 1)
+		}
+	}
+	us.Sequence = seq
+	return true
+}
+
+// expire forgets the universes, and the sources, that have been
+// silent for mergeTimeout.
+func (r *Receiver) expire(now time.Time) {
+	r.lastExpire = now
+	for from, src := range r.sources {
+		for addr, us := range src {
+			if now.Sub(us.LastSeen) >= mergeTimeout {
+				delete(src, addr)
+			}
+		}
+		if len(src) == 0 {
+			delete(r.sources, from)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package artnet
+
+import (
+	"image"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestReceiverStats(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	from := netip.MustParseAddrPort("10.0.0.1:6454")
+
+	// send numbers the packets of a frame, which are
+	// numbered in byte 12.
+	send := func(seed int64, seq uint8, universes int) {
+		for _, b := range dmxPackets(t, randomImage(seed))[:universes] {
+			b[12] = seq
+			r.handle(b, from)
+		}
+	}
+
+	send(1, 1, 4)
+	send(2, 2, 2) // half a frame
+	send(3, 2, 4) // duplicates universes 0 and 1, then completes it
+	send(4, 1, 4) // stale
+	send(5, 5, 4) // after 3 and 4 were lost
+	send(6, 120, 4)
+	send(7, 240, 4)
+	send(8, 255, 4)
+	send(9, 1, 4) // after 255 comes 1
+	r.handle([]byte("garbage"), from)
+
+	st := r.Stats()
+	if st.Frames != 7 || st.Incomplete != 0 || st.Invalid != 1 {
+		t.Errorf("frames %d incomplete %d invalid %d", st.Frames, st.Incomplete, st.Invalid)
+	}
+	us := st.Sources[from.String()][1]
+	want := UniverseStats{
+		Packets:    9,
+		Bytes:      9 * 512,
+		Duplicates: 1,
+		Stale:      1,
+		Lost:       2 + 114 + 119 + 14,
+		Sequence:   1,
+		LastSeen:   us.LastSeen,
+	}
+	if us != want {
+		t.Errorf("universe 1 stats %+v, want %+v", us, want)
+	}
+	if u0 := st.Sources[from.String()][0]; u0.Duplicates != 1 || u0.Packets != 9 {
+		t.Errorf("universe 0 stats %+v", u0)
+	}
+
+	// Without sequence numbers, a repeated universe abandons the
+	// frame.
+	send(10, 0, 2)
+	send(11, 0, 4)
+	st = r.Stats()
+	if st.Frames != 8 || st.Incomplete != 1 || st.CompletionRate() != 8.0/9 {
+		t.Errorf("frames %d incomplete %d", st.Frames, st.Incomplete)
+	}
+}
+
+func TestReceiverStatsExpire(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	pkts := dmxPackets(t, randomImage(1))
+	send := func(port uint16) {
+		r.handle(pkts[0], netip.AddrPortFrom(netip.MustParseAddr("10.0.0.1"), port))
+	}
+
+	// A sender that changes its source port, or spoofs many, is
+	// tracked to a limit.
+	for port := uint16(0); port < 2*maxSources; port++ {
+		send(port)
+	}
+	if n := len(r.Stats().Sources); n != maxSources {
+		t.Fatalf("%d sources", n)
+	}
+
+	// Nor does a source of every Port-Address add more than the
+	// universes of the frame.
+	for addr := 0; addr < 1<<15; addr++ {
+		pkts[1][14], pkts[1][15] = uint8(addr), uint8(addr>>8)
+		r.handle(pkts[1], netip.AddrPortFrom(netip.MustParseAddr("10.0.0.1"), 0))
+	}
+	if n := len(r.Stats().Sources["10.0.0.1:0"]); n != len(pkts) {
+		t.Fatalf("%d universes", n)
+	}
+
+	// Silent sources are forgotten.
+	now = now.Add(mergeTimeout / 2)
+	send(1)
+	now = now.Add(mergeTimeout / 2)
+	send(2)
+	if st := r.Stats(); len(st.Sources) != 2 || st.Sources["10.0.0.1:1"][0].Packets != 2 {
+		t.Errorf("sources after expiry %+v", st.Sources)
+	}
+}
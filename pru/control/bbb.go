@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log"
@@ -35,6 +36,11 @@ type controlStruct struct {
 	// startBank is the most recent bank started by the PRU.
 	startBank uint32
 
+	// framebufScans and framebufWidth are the geometry the
+	// firmware was built for, which must match the Layout.
+	framebufScans uint32
+	framebufWidth uint32
+
 	// The ARM can be in two states:
 	// 1. Waiting for startBank to equal readyBank.
 	// 2. Writing to (readyBank^1) before updating readyBank.
@@ -68,6 +74,10 @@ func newAppState(buf *gpixio.Buffer) (*appState, error) {
 	if err != nil {
 		return nil, err
 	}
+	if l := buf.Layout(); int(ctrl.framebufScans) != l.Scan || int(ctrl.framebufWidth) != l.Clocks() {
+		return nil, fmt.Errorf("PRU firmware drives %d rows of %d pixels, the layout %d of %d: rebuild it with make FRAMEBUF_SCANS=%d FRAMEBUF_WIDTH=%d",
+			ctrl.framebufScans, ctrl.framebufWidth, l.Scan, l.Clocks(), l.Scan, l.Clocks())
+	}
 
 	go func() {
 		before := atomic.LoadUint32(&ctrl.frameCount)
@@ -93,8 +103,10 @@ func (state *appState) finish(bank uint32) {
 	atomic.StoreUint32(&state.ctrl.readyBank, bank)
 }
 
-func (state *appState) run() error {
-	select {}
+// run displays banks until ctx ends.
+func (state *appState) run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
 }
 
 func (state *appState) waitReady() uint32 {
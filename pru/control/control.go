@@ -28,6 +28,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	// Note: from when I borrowed Tracy's APC Mini controller
@@ -38,6 +40,7 @@ import (
 	"github.com/jmacd/nerve/pru/artnet"
 	"github.com/jmacd/nerve/pru/gpixio"
 	"github.com/jmacd/nerve/pru/program/player"
+	"github.com/jmacd/nerve/pru/sacn"
 )
 
 type (
@@ -49,86 +52,220 @@ type (
 
 var (
 	haveControl = flag.Bool("control", true, "have a midi controller")
+
+	panelWidth  = flag.Int("panel_width", gpixio.DefaultLayout.PanelWidth, "panel width in pixels")
+	panelHeight = flag.Int("panel_height", gpixio.DefaultLayout.PanelHeight, "panel height in pixels")
+	panelScan   = flag.Int("scan", gpixio.DefaultLayout.Scan, "panel row addresses (e.g., 16 for 1/16 scan)")
+	panelChain  = flag.Int("chain", gpixio.DefaultLayout.Chain, "panels chained per output")
+	outputs     = flag.Int("outputs", gpixio.DefaultLayout.Outputs, "cape outputs in use")
+	stack       = flag.Int("stack", gpixio.DefaultLayout.Stack, "outputs stacked per column")
+
+	capeFile = flag.String("cape", "", "FPP cape descriptor (default: Octoscroller)")
+	pinFile  = flag.String("pins", "", "BeagleBone pin table (default: BeagleBone Black)")
+
+	depth          = flag.Int("depth", 0, "bits per color channel (default: 6, or the most the layout's bank allows)")
+	ditherTemporal = flag.Bool("dither_temporal", false, "dither across PWM cycles and frames")
+	ditherSpatial  = flag.Bool("dither_spatial", false, "dither in a 4x4 ordered pattern")
+
+	curveName   = flag.String("curve", "", "transfer curve: srgb, lstar, a gamma, or a LUT file (default: gamma 2.2 for network input, linear for local programs; their gamma knob raises either to a power)")
+	calibration = flag.String("calibration", "", "color calibration profile for outputs and panels")
+
+	artnetUniverse     = flag.Int("artnet_universe", int(artnet.DefaultConfig.StartUniverse), "Art-Net Port-Address of the first universe (net<<8 | subnet<<4 | universe)")
+	artnetChannels     = flag.Int("artnet_channels", artnet.DefaultConfig.ChannelsPerUniverse, "DMX channels used per universe")
+	artnetStartChannel = flag.Int("artnet_start_channel", artnet.DefaultConfig.StartChannel+1, "DMX channel (from 1) of the first pixel")
+	artnetName         = flag.String("artnet_name", artnet.DefaultConfig.ShortName, "Art-Net node short name")
+	artnetLongName     = flag.String("artnet_long_name", artnet.DefaultConfig.LongName, "Art-Net node long name")
+	artnetOrder        = flag.String("artnet_order", "RGB", "Art-Net channel order of each pixel, of R, G, B and an optional W")
+	artnetDepth        = flag.Int("artnet_depth", 1, "bytes per Art-Net channel, 1 or 2")
+	artnetSize         = flag.String("artnet_size", "", "size of the Art-Net frame received, WxH, if other than the panels")
+	artnetFit          = flag.String("artnet_fit", artnet.FitStretch, "how to scale a frame of another size: stretch, letterbox, crop or none")
+	artnetRegion       = flag.String("artnet_region", "", "region of the panels the Art-Net frame is drawn in, WxH+X+Y, if not all")
+	artnetMerge        = flag.String("artnet_merge", artnet.DefaultConfig.Merge, "how to merge universes from two Art-Net sources: htp or ltp")
+	artnetRecord       = flag.String("artnet_record", "", "file to record the Art-Net frames received to, for replay by artrec")
+	artnetShared       = flag.Bool("artnet_shared", false, "share the Art-Net port with other receivers on the host, such as artmon -shared")
+	artnetConfig       = flag.String("artnet_config", "", "file where ArtAddress changes are saved, read at startup in place of the artnet flags")
+
+	signalTimeout = flag.Duration("signal_timeout", 0, "time without network frames before showing the signal_loss fallback (0 holds the last frame)")
+	signalLoss    = flag.String("signal_loss", lossBlack, "fallback when network frames stop: hold, black, standby or player")
+	signalFade    = flag.Duration("signal_fade", 2*time.Second, "time to fade from the last frame to black or the standby image")
+	standbyImage  = flag.String("standby_image", "", "image shown by signal_loss=standby")
+
+	sacnUniverse     = flag.Int("sacn_universe", int(sacn.DefaultConfig.StartUniverse), "sACN universe of the first pixels")
+	sacnChannels     = flag.Int("sacn_channels", sacn.DefaultConfig.ChannelsPerUniverse, "DMX channels used per universe")
+	sacnStartChannel = flag.Int("sacn_start_channel", sacn.DefaultConfig.StartChannel+1, "DMX channel (from 1) of the first pixel")
+
+	ampsPerLED = flag.Float64("amps_per_led", 0.01, "current through one lit LED channel, for the power estimate logged each minute")
+	maxAmps    = flag.Float64("amps", 0, "limit on the estimated total current (0 is unlimited)")
+	outputAmps = flag.Float64("output_amps", 0, "limit on the estimated current per output (0 is unlimited)")
 )
 
 func Main() error {
 	flag.Parse()
 
-	var err error
-
-	buf := gpixio.NewBuffer()
-	state, err := newAppState(buf)
+	pins, err := gpixio.LoadPinout(*capeFile, *pinFile)
 	if err != nil {
 		return err
 	}
-
-	recvFrom := os.Getenv("ARTNET_RECVFROM")
-
-	if recvFrom != "" {
-		recv, err := artnet.NewReceiver(recvFrom, buf.RGBA)
+	buf, err := gpixio.NewBufferLayout(gpixio.Layout{
+		PanelWidth:  *panelWidth,
+		PanelHeight: *panelHeight,
+		Scan:        *panelScan,
+		Chain:       *panelChain,
+		Outputs:     *outputs,
+		Stack:       *stack,
+	}, pins)
+	if err != nil {
+		return err
+	}
+	if *depth != 0 {
+		if err := buf.SetDepth(*depth); err != nil {
+			return err
+		}
+	}
+	dither := gpixio.DitherNone
+	if *ditherTemporal {
+		dither |= gpixio.DitherTemporal
+	}
+	if *ditherSpatial {
+		dither |= gpixio.DitherSpatial
+	}
+	buf.SetDither(dither)
+	if *calibration != "" {
+		profile, err := gpixio.LoadProfile(*calibration)
 		if err != nil {
 			return err
 		}
-		ctx := context.Background()
-		if err = recv.Start(ctx); err != nil {
+		if err := buf.SetProfile(profile); err != nil {
 			return err
 		}
+	}
+	if err := buf.SetPowerLimit(gpixio.PowerLimit{
+		AmpsPerLED: *ampsPerLED,
+		Amps:       *maxAmps,
+		OutputAmps: *outputAmps,
+	}); err != nil {
+		return err
+	}
+	var curve gpixio.Curve
+	if *curveName != "" {
+		if curve, err = gpixio.ParseCurve(*curveName); err != nil {
+			return err
+		}
+	}
+	state, err := newAppState(buf)
+	if err != nil {
+		return err
+	}
 
-		go func() {
-			for {
-				recv.Draw()
-
-				bank := state.waitReady()
-
-				const gamma = 2.2
-				buf.Copy0(gamma, &state.frames[bank])
-
-				state.finish(bank)
-
-				// Let the UDP receiver do some work.
-				time.Sleep(time.Second / 30)
+	recv, protocol, finish, err := newReceiver(buf.RGBA)
+	if err != nil {
+		return err
+	}
+	if finish != nil {
+		defer func() {
+			if err := finish(); err != nil {
+				log.Println(protocol, "finish:", err)
 			}
 		}()
+	}
 
-	} else {
-		var input controller.Input // *xl.LaunchControl
-
-		if !*haveControl {
-			input = noInput{}
-		} else {
-			lx, err := xl.Open()
-			if err != nil || lx == nil {
-				return fmt.Errorf("error while opening connection to launchctl: %w", err)
-			}
-			defer lx.Close()
+	// ctx ends on SIGINT or SIGTERM, for the deferred cleanup to
+	// run, e.g., to finish a recording.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go logPower(ctx, buf)
+
+	// show encodes the frame in buf, by the curve flag, else one
+	// suited to network input or, for the local programs, linear.
+	// Their gamma knob, if not zero, raises the curve to its power.
+	show := func(knob float64) {
+		bank := state.waitReady()
+		c := curve
+		switch {
+		case c != nil:
+		case knob == 0:
+			c = gpixio.Gamma(2.2)
+		default:
+			c = gpixio.Gamma(1)
+		}
+		if knob != 0 {
+			c = gpixio.Adjust(c, knob)
+		}
+		buf.Copy1(c, &state.frames[bank])
+		state.finish(bank)
+	}
 
-			input = lx
+	// newPlayer starts the local player, with the midi
+	// controller, which is closed when Main returns.  It is
+	// called at most once.
+	var closeInput func()
+	defer func() {
+		if closeInput != nil {
+			closeInput()
+		}
+	}()
+	newPlayer := func() (*player.Player, error) {
+		input, closer, err := openInput()
+		if err != nil {
+			return nil, err
+		}
+		closeInput = closer
+		return player.New(input), nil
+	}
 
-			go func() {
-				err := lx.Run(context.Background())
-				if err != nil {
-					log.Println("LX control run:", err)
-				}
-				log.Println("LX control exit")
-			}()
+	if recv != nil {
+		if err = recv.Start(ctx); err != nil {
+			return err
 		}
+		go logStats(ctx, recv)
 
-		player := player.New(input)
+		fb, err := newFallback(buf.RGBA, newPlayer)
+		if err != nil {
+			return err
+		}
+		go receive(ctx, recv, protocol, buf.RGBA, fb, show)
+
+	} else {
+		player, err := newPlayer()
+		if err != nil {
+			return err
+		}
 
 		go func() {
 			for {
 				player.Draw(buf.RGBA)
+				show(gammaKnob(player))
+			}
+		}()
+	}
 
-				bank := state.waitReady()
+	return state.run(ctx)
+}
 
-				buf.Copy0(1+2*player.Data.KnobsRow3[7].Float(), &state.frames[bank])
+// gammaKnob is the power, from 1 to 3, set by the gamma knob.
+func gammaKnob(p *player.Player) float64 {
+	return 1 + 2*p.Data.KnobsRow3[7].Float()
+}
 
-				state.finish(bank)
-			}
-		}()
+// openInput opens the midi controller, if there is one, returning
+// it with a function to close it.
+func openInput() (controller.Input, func(), error) {
+	if !*haveControl {
+		return noInput{}, func() {}, nil
+	}
+	lx, err := xl.Open()
+	if err != nil || lx == nil {
+		return nil, nil, fmt.Errorf("error while opening connection to launchctl: %w", err)
 	}
 
-	return state.run()
+	go func() {
+		err := lx.Run(context.Background())
+		if err != nil {
+			log.Println("LX control run:", err)
+		}
+		log.Println("LX control exit")
+	}()
+	return lx, func() { lx.Close() }, nil
 }
 
 type noInput struct{}
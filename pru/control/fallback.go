@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"time"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/jmacd/nerve/pru/program/player"
+	"golang.org/x/image/draw"
+)
+
+// fallbackInterval is how often the fallback is drawn, and the
+// receiver checked for frames, once the signal is lost.
+const fallbackInterval = time.Second / 60
+
+// Signal-loss modes, for the signal_loss flag.
+const (
+	lossHold    = "hold"
+	lossBlack   = "black"
+	lossStandby = "standby"
+	lossPlayer  = "player"
+)
+
+// fallback is shown when network frames stop, from the last frame
+// received.  It fades to black or to a standby image, or runs the
+// local player.
+type fallback struct {
+	mode    string
+	timeout time.Duration
+	fade    time.Duration
+
+	// target is faded to from last, black unless standby.
+	last   *image.RGBA
+	target *image.RGBA
+	player *player.Player
+
+	// lost is when the fallback began, and done is set when it
+	// has nothing more to draw.
+	lost time.Time
+	done bool
+}
+
+// newFallback returns the fallback set by the flags for frames the
+// size of out, or nil to hold the last frame.  The player is started
+// with newPlayer, if used.
+func newFallback(out *image.RGBA, newPlayer func() (*player.Player, error)) (*fallback, error) {
+	if *signalLoss == lossHold || *signalTimeout <= 0 {
+		return nil, nil
+	}
+	f := &fallback{
+		mode:    *signalLoss,
+		timeout: *signalTimeout,
+		fade:    *signalFade,
+		last:    image.NewRGBA(out.Bounds()),
+		target:  image.NewRGBA(out.Bounds()),
+	}
+	switch f.mode {
+	case lossBlack:
+	case lossStandby:
+		if *standbyImage == "" {
+			return nil, errors.New("signal_loss=standby needs a standby_image")
+		}
+		img, err := loadImage(*standbyImage)
+		if err != nil {
+			return nil, err
+		}
+		draw.ApproxBiLinear.Scale(f.target, f.target.Rect, img, img.Bounds(), draw.Src, nil)
+	case lossPlayer:
+		p, err := newPlayer()
+		if err != nil {
+			return nil, err
+		}
+		f.player = p
+	default:
+		return nil, fmt.Errorf("signal_loss %q is not %s, %s, %s or %s", f.mode, lossHold, lossBlack, lossStandby, lossPlayer)
+	}
+	return f, nil
+}
+
+// loadImage reads a PNG, JPEG or GIF file.
+func loadImage(name string) (image.Image, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	return img, nil
+}
+
+// begin starts the fallback from the last frame, in out.
+func (f *fallback) begin(out *image.RGBA, now time.Time) {
+	copy(f.last.Pix, out.Pix)
+	f.lost = now
+	f.done = false
+}
+
+// draw draws the fallback into out and returns the gamma knob to
+// encode it with, zero if none, or false if out is unchanged.
+func (f *fallback) draw(out *image.RGBA, now time.Time) (float64, bool) {
+	if f.done {
+		return 0, false
+	}
+	if f.player != nil {
+		f.player.Draw(out)
+		return gammaKnob(f.player), true
+	}
+
+	// Blend in 256ths, from last to target.
+	a := 256
+	if f.fade > 0 && now.Sub(f.lost) < f.fade {
+		a = int(256 * now.Sub(f.lost) / f.fade)
+	}
+	for i := range out.Pix {
+		out.Pix[i] = uint8((int(f.last.Pix[i])*(256-a) + int(f.target.Pix[i])*a + 128) >> 8)
+	}
+	f.done = a == 256
+	return 0, true
+}
+
+// receive encodes frames from the receiver, which copies them to out,
+// as they arrive.  With a fallback, once none arrive for its timeout,
+// it draws the fallback in out until they resume.  The gamma knob, if
+// not zero, is that of the fallback.
+func receive(ctx context.Context, recv receiver, protocol string, out *image.RGBA, fb *fallback, show func(knob float64)) {
+	var seq uint64
+	var lost bool
+	for {
+		wait := ctx
+		var cancel context.CancelFunc = func() {}
+		switch {
+		case lost:
+			wait, cancel = context.WithTimeout(ctx, fallbackInterval)
+		case fb != nil:
+			wait, cancel = context.WithTimeout(ctx, fb.timeout)
+		}
+		// Encode only when a new frame arrives.
+		next, err := recv.Next(wait, seq)
+		cancel()
+
+		switch {
+		case err == nil:
+			if lost {
+				log.Println(protocol, "signal resumed")
+				lost = false
+			}
+			seq = next
+			show(0)
+
+		case ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			now := time.Now()
+			if !lost {
+				log.Printf("%s signal lost for %v, showing %s", protocol, fb.timeout, fb.mode)
+				fb.begin(out, now)
+				lost = true
+			}
+			if knob, ok := fb.draw(out, now); ok {
+				show(knob)
+			}
+
+		default:
+			log.Println(protocol, "receive:", err)
+			return
+		}
+	}
+}
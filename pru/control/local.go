@@ -3,7 +3,12 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
+	"io"
+	"log"
 	"os"
 	"time"
 
@@ -12,12 +17,18 @@ import (
 	"fyne.io/fyne/canvas"
 	"github.com/jmacd/nerve/pru/artnet"
 	"github.com/jmacd/nerve/pru/gpixio"
+	"github.com/jmacd/nerve/pru/sacn"
 )
 
+// sender is the Art-Net or sACN Sender of the frames displayed.
+type sender interface {
+	Send(*image.RGBA) error
+}
+
 type appState struct {
 	frames *Frameset
 	buf    *gpixio.Buffer
-	sender *artnet.Sender
+	sender sender
 
 	inputWindow fyne.Window
 	// outputWindow fyne.Window
@@ -32,14 +43,14 @@ type appState struct {
 
 func newAppState(buf *gpixio.Buffer) (*appState, error) {
 
-	var sender *artnet.Sender
-	if sendTo := os.Getenv("ARTNET_SENDTO"); sendTo != "" {
-		sender = artnet.NewSender(sendTo)
+	sender, err := newSender()
+	if err != nil {
+		return nil, err
 	}
 
 	app := app.New()
 
-	outputPixels := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	outputPixels := image.NewRGBA(buf.Bounds())
 
 	inputWindow := app.NewWindow("Image")
 	inputImage := canvas.NewImageFromImage(buf.RGBA)
@@ -66,10 +77,33 @@ func newAppState(buf *gpixio.Buffer) (*appState, error) {
 	}, nil
 }
 
+// newSender returns the sender selected by the environment, where
+// ARTNET_SENDTO or SACN_SENDTO is the address to send to.  Without
+// either, it returns nil.
+func newSender() (sender, error) {
+	artnetTo, sacnTo := os.Getenv("ARTNET_SENDTO"), os.Getenv("SACN_SENDTO")
+	switch {
+	case artnetTo != "" && sacnTo != "":
+		return nil, errors.New("set only one of ARTNET_SENDTO and SACN_SENDTO")
+	case artnetTo != "":
+		s := artnet.NewSender(artnetTo)
+		s.Format = artnetFormat()
+		return s, nil
+	case sacnTo != "":
+		if *sacnUniverse < 1 || *sacnUniverse > sacn.MaxUniverse {
+			return nil, fmt.Errorf("sacn_universe %d is not in [1, %d]", *sacnUniverse, sacn.MaxUniverse)
+		}
+		s := sacn.NewSender(sacnTo)
+		s.StartUniverse = uint16(*sacnUniverse)
+		return s, nil
+	}
+	return nil, nil
+}
+
 func (state *appState) finish(bank uint32) {
 	fb := &state.frames[bank]
 
-	testRender(fb, state.outputPixels)
+	state.buf.DecodeTo(state.outputPixels, fb)
 
 	if state.sender != nil {
 		state.sender.Send(state.buf.RGBA)
@@ -83,9 +117,21 @@ func (state *appState) finish(bank uint32) {
 	time.Sleep(time.Millisecond * 200)
 }
 
-func (state *appState) run() error {
+// run shows the window until it is closed or ctx ends.
+func (state *appState) run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		fyne.CurrentApp().Quit()
+	}()
 	// state.outputWindow.Show()
 	state.inputWindow.ShowAndRun()
+
+	// The sACN sender tells receivers the universes have stopped.
+	if c, ok := state.sender.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Println("sender close:", err)
+		}
+	}
 	return nil
 }
 
@@ -94,187 +140,3 @@ func (state *appState) waitReady() uint32 {
 	state.bank = b ^ 1
 	return b
 }
-
-func testRender(fb *gpixio.FrameBank, img *image.RGBA) {
-	for i := 0; i < len(img.Pix); i += 4 {
-		img.Pix[i+0] = 0
-		img.Pix[i+1] = 0
-		img.Pix[i+2] = 0
-		img.Pix[i+3] = 255
-	}
-
-	for fi := 0; fi < 256; fi++ {
-		for dri := 0; dri < 16; dri++ {
-			for dpi := 0; dpi < 64; dpi++ {
-				dp := fb[fi][dri][dpi]
-
-				// 4 = bytes per pixel, 128 = image width
-
-				// The following 16 positions are manual
-				j11Off := 4 * (128*(dri+0) + dpi)
-				j12Off := 4 * (128*(dri+16) + dpi)
-				j21Off := 4 * (128*(dri+32) + dpi)
-				j22Off := 4 * (128*(dri+48) + dpi)
-				j31Off := 4 * (128*(dri+64) + dpi)
-				j32Off := 4 * (128*(dri+80) + dpi)
-				j41Off := 4 * (128*(dri+96) + dpi)
-				j42Off := 4 * (128*(dri+112) + dpi)
-
-				j51Off := 4 * (128*(dri+0) + 64 + dpi)
-				j52Off := 4 * (128*(dri+16) + 64 + dpi)
-				j61Off := 4 * (128*(dri+32) + 64 + dpi)
-				j62Off := 4 * (128*(dri+48) + 64 + dpi)
-				j71Off := 4 * (128*(dri+64) + 64 + dpi)
-				j72Off := 4 * (128*(dri+80) + 64 + dpi)
-				j81Off := 4 * (128*(dri+96) + 64 + dpi)
-				j82Off := 4 * (128*(dri+112) + 64 + dpi)
-
-				// The following code was generated by ../../cmd/mkmap
-				if dp.Gpio2&(1<<4) != 0 {
-					img.Pix[j12Off+1]++
-				}
-				if dp.Gpio0&(1<<26) != 0 {
-					img.Pix[j12Off+2]++
-				}
-				if dp.Gpio2&(1<<2) != 0 {
-					img.Pix[j11Off+0]++
-				}
-				if dp.Gpio2&(1<<3) != 0 {
-					img.Pix[j11Off+1]++
-				}
-				if dp.Gpio2&(1<<5) != 0 {
-					img.Pix[j11Off+2]++
-				}
-				if dp.Gpio0&(1<<23) != 0 {
-					img.Pix[j12Off+0]++
-				}
-				if dp.Gpio2&(1<<23) != 0 {
-					img.Pix[j22Off+1]++
-				}
-				if dp.Gpio2&(1<<24) != 0 {
-					img.Pix[j22Off+2]++
-				}
-				if dp.Gpio0&(1<<27) != 0 {
-					img.Pix[j21Off+0]++
-				}
-				if dp.Gpio2&(1<<1) != 0 {
-					img.Pix[j21Off+1]++
-				}
-				if dp.Gpio0&(1<<22) != 0 {
-					img.Pix[j21Off+2]++
-				}
-				if dp.Gpio2&(1<<22) != 0 {
-					img.Pix[j22Off+0]++
-				}
-				if dp.Gpio1&(1<<18) != 0 {
-					img.Pix[j31Off+1]++
-				}
-				if dp.Gpio0&(1<<31) != 0 {
-					img.Pix[j31Off+2]++
-				}
-				if dp.Gpio1&(1<<16) != 0 {
-					img.Pix[j32Off+0]++
-				}
-				if dp.Gpio0&(1<<3) != 0 {
-					img.Pix[j32Off+1]++
-				}
-				if dp.Gpio0&(1<<5) != 0 {
-					img.Pix[j32Off+2]++
-				}
-				if dp.Gpio0&(1<<30) != 0 {
-					img.Pix[j31Off+0]++
-				}
-				if dp.Gpio0&(1<<2) != 0 {
-					img.Pix[j41Off+0]++
-				}
-				if dp.Gpio0&(1<<15) != 0 {
-					img.Pix[j41Off+1]++
-				}
-				if dp.Gpio1&(1<<17) != 0 {
-					img.Pix[j41Off+2]++
-				}
-				if dp.Gpio3&(1<<21) != 0 {
-					img.Pix[j42Off+0]++
-				}
-				if dp.Gpio3&(1<<19) != 0 {
-					img.Pix[j42Off+1]++
-				}
-				if dp.Gpio0&(1<<4) != 0 {
-					img.Pix[j42Off+2]++
-				}
-				if dp.Gpio0&(1<<11) != 0 {
-					img.Pix[j51Off+1]++
-				}
-				if dp.Gpio0&(1<<10) != 0 {
-					img.Pix[j51Off+2]++
-				}
-				if dp.Gpio0&(1<<9) != 0 {
-					img.Pix[j52Off+0]++
-				}
-				if dp.Gpio0&(1<<8) != 0 {
-					img.Pix[j52Off+1]++
-				}
-				if dp.Gpio2&(1<<17) != 0 {
-					img.Pix[j52Off+2]++
-				}
-				if dp.Gpio2&(1<<25) != 0 {
-					img.Pix[j51Off+0]++
-				}
-				if dp.Gpio2&(1<<16) != 0 {
-					img.Pix[j61Off+0]++
-				}
-				if dp.Gpio2&(1<<15) != 0 {
-					img.Pix[j61Off+1]++
-				}
-				if dp.Gpio2&(1<<14) != 0 {
-					img.Pix[j61Off+2]++
-				}
-				if dp.Gpio2&(1<<13) != 0 {
-					img.Pix[j62Off+0]++
-				}
-				if dp.Gpio2&(1<<10) != 0 {
-					img.Pix[j62Off+1]++
-				}
-				if dp.Gpio2&(1<<12) != 0 {
-					img.Pix[j62Off+2]++
-				}
-				if dp.Gpio2&(1<<6) != 0 {
-					img.Pix[j72Off+0]++
-				}
-				if dp.Gpio3&(1<<18) != 0 {
-					img.Pix[j72Off+1]++
-				}
-				if dp.Gpio2&(1<<7) != 0 {
-					img.Pix[j72Off+2]++
-				}
-				if dp.Gpio2&(1<<11) != 0 {
-					img.Pix[j71Off+0]++
-				}
-				if dp.Gpio2&(1<<9) != 0 {
-					img.Pix[j71Off+1]++
-				}
-				if dp.Gpio2&(1<<8) != 0 {
-					img.Pix[j71Off+2]++
-				}
-				if dp.Gpio0&(1<<14) != 0 {
-					img.Pix[j82Off+1]++
-				}
-				if dp.Gpio3&(1<<20) != 0 {
-					img.Pix[j82Off+2]++
-				}
-				if dp.Gpio3&(1<<17) != 0 {
-					img.Pix[j81Off+0]++
-				}
-				if dp.Gpio3&(1<<16) != 0 {
-					img.Pix[j81Off+1]++
-				}
-				if dp.Gpio3&(1<<15) != 0 {
-					img.Pix[j81Off+2]++
-				}
-				if dp.Gpio3&(1<<14) != 0 {
-					img.Pix[j82Off+0]++
-				}
-			}
-		}
-	}
-}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmacd/nerve/pru/artnet"
+	"github.com/jmacd/nerve/pru/ddp"
+	"github.com/jmacd/nerve/pru/gpixio"
+	"github.com/jmacd/nerve/pru/sacn"
+)
+
+// receiver is a network source of frames.
+type receiver interface {
+	Start(ctx context.Context) error
+	Next(ctx context.Context, after uint64) (uint64, error)
+}
+
+// newReceiver returns the receiver selected by the environment, where
+// ARTNET_RECVFROM, SACN_RECVFROM or DDP_RECVFROM is the address to
+// receive on, the name of its protocol, and a function to finish it
+// on exit, if any.  Without any, it returns nil.
+func newReceiver(out *image.RGBA) (receiver, string, func() error, error) {
+	var protocol, recvFrom string
+	for _, p := range []string{"artnet", "sacn", "ddp"} {
+		addr := os.Getenv(strings.ToUpper(p) + "_RECVFROM")
+		if addr == "" {
+			continue
+		}
+		if protocol != "" {
+			return nil, "", nil, errors.New("set only one of ARTNET_RECVFROM, SACN_RECVFROM and DDP_RECVFROM")
+		}
+		protocol, recvFrom = p, addr
+	}
+
+	var recv receiver
+	var finish func() error
+	var err error
+	switch protocol {
+	case "artnet":
+		recv, finish, err = newArtnetReceiver(recvFrom, out)
+	case "sacn":
+		recv, err = newSACNReceiver(recvFrom, out)
+	case "ddp":
+		recv, err = ddp.NewReceiver(recvFrom, out)
+	default:
+		return nil, "", nil, nil
+	}
+	return recv, protocol, finish, err
+}
+
+// newArtnetReceiver returns an Art-Net receiver configured by the
+// flags, with a function to finish its recording, if any.
+func newArtnetReceiver(recvFrom string, out *image.RGBA) (receiver, func() error, error) {
+	if *artnetUniverse < 0 || *artnetUniverse >= 1<<15 {
+		return nil, nil, fmt.Errorf("artnet_universe %d is not a 15-bit Port-Address", *artnetUniverse)
+	}
+	cfg := artnet.Config{
+		StartUniverse:       uint16(*artnetUniverse),
+		ChannelsPerUniverse: *artnetChannels,
+		StartChannel:        *artnetStartChannel - 1,
+		ShortName:           *artnetName,
+		LongName:            *artnetLongName,
+		Format:              artnetFormat(),
+		Fit:                 *artnetFit,
+		Merge:               *artnetMerge,
+	}
+	if *artnetSize != "" {
+		if _, err := fmt.Sscanf(*artnetSize, "%dx%d", &cfg.Width, &cfg.Height); err != nil {
+			return nil, nil, fmt.Errorf("artnet_size %q is not WxH", *artnetSize)
+		}
+	}
+	if *artnetRegion != "" {
+		var w, h, x, y int
+		if _, err := fmt.Sscanf(*artnetRegion, "%dx%d+%d+%d", &w, &h, &x, &y); err != nil {
+			return nil, nil, fmt.Errorf("artnet_region %q is not WxH+X+Y", *artnetRegion)
+		}
+		cfg.Region = image.Rect(x, y, x+w, y+h)
+	}
+	if *artnetConfig != "" {
+		saved, err := artnet.LoadConfig(*artnetConfig)
+		switch {
+		case err == nil:
+			cfg = saved
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, nil, err
+		}
+	}
+	cfg.Shared = *artnetShared
+	recv, err := artnet.NewReceiverConfig(recvFrom, out, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	recv.SetConfigFile(*artnetConfig)
+	if *artnetRecord == "" {
+		return recv, nil, nil
+	}
+	file, err := os.Create(*artnetRecord)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec, err := artnet.NewRecorder(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	recv.SetRecorder(rec)
+
+	finish := func() error {
+		if err := rec.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+	return recv, finish, nil
+}
+
+// artnetFormat returns the pixel format set by the flags.
+func artnetFormat() artnet.Format {
+	return artnet.Format{
+		Order: strings.ToUpper(*artnetOrder),
+		Depth: *artnetDepth,
+	}
+}
+
+func newSACNReceiver(recvFrom string, out *image.RGBA) (receiver, error) {
+	if *sacnUniverse < 1 || *sacnUniverse > sacn.MaxUniverse {
+		return nil, fmt.Errorf("sacn_universe %d is not in [1, %d]", *sacnUniverse, sacn.MaxUniverse)
+	}
+	recv, err := sacn.NewReceiverConfig(recvFrom, out, sacn.Config{
+		StartUniverse:       uint16(*sacnUniverse),
+		ChannelsPerUniverse: *sacnChannels,
+		StartChannel:        *sacnStartChannel - 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recv, nil
+}
+
+// statsInterval is how often receiver statistics and the power
+// estimate are logged.
+const statsInterval = time.Minute
+
+// logStats logs the statistics of recv periodically, for the
+// receivers that keep them.
+func logStats(ctx context.Context, recv receiver) {
+	var logf func()
+	switch r := recv.(type) {
+	case *artnet.Receiver:
+		logf = func() { logArtnetStats(r.Stats()) }
+	case *sacn.Receiver:
+		logf = func() {
+			st := r.Stats()
+			log.Printf("sacn: %d frames, %d incomplete (%.1f%% complete)",
+				st.Frames, st.Incomplete, 100*st.CompletionRate())
+		}
+	default:
+		return
+	}
+	tick := time.NewTicker(statsInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		logf()
+	}
+}
+
+// logPower logs the power estimate of buf periodically, in total and
+// for each output, with the peak to size supplies by.
+func logPower(ctx context.Context, buf *gpixio.Buffer) {
+	tick := time.NewTicker(statsInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		p := buf.Power()
+		log.Printf("power: %.2f A, peak %.2f A, scale %.2f", p.Total, p.Peak, p.Scale)
+		for o, amps := range p.Outputs {
+			log.Printf("power: J%d %.2f A", o+1, amps)
+		}
+	}
+}
+
+// logArtnetStats logs the statistics of an Art-Net receiver, with
+// those of each source.
+func logArtnetStats(st artnet.ReceiveStats) {
+	log.Printf("artnet: %d frames, %d incomplete (%.1f%% complete), %d invalid packets, %d ignored",
+		st.Frames, st.Incomplete, 100*st.CompletionRate(), st.Invalid, st.Ignored)
+
+	srcs := make([]string, 0, len(st.Sources))
+	for src := range st.Sources {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	for _, src := range srcs {
+		for u, us := range st.Sources[src] {
+			log.Printf("artnet: %s universe %d: %d packets, %d lost, %d stale, %d duplicate",
+				src, u, us.Packets, us.Lost, us.Stale, us.Duplicates)
+		}
+	}
+}
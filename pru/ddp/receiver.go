@@ -0,0 +1,321 @@
+// Package ddp receives frames in the Distributed Display Protocol,
+// which carries pixel data by byte offset in packets of up to 1440
+// bytes, without slicing it into DMX universes.
+package ddp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jmacd/nerve/pru/frame"
+)
+
+const (
+	// Port is the DDP UDP port.
+	Port = 4048
+
+	receiverQueueLen = 1000
+	maxPacketSize    = 1500
+
+	headerSize   = 10
+	timecodeSize = 4
+
+	// Flags, in the first byte.
+	flagVersion  = 0x40
+	versionMask  = 0xc0
+	flagTimecode = 0x10
+	flagReply    = 0x04
+	flagQuery    = 0x02
+	flagPush     = 0x01
+
+	// Data types of 8-bit RGB: undefined, the original value, and
+	// the current one.
+	typeUndefined = 0x00
+	typeRGBLegacy = 0x01
+	typeRGB8      = 0x0b
+
+	// Destination IDs.
+	idDisplay = 1
+	idConfig  = 250
+	idStatus  = 251
+	idAll     = 255
+
+	// ntpOffset is the NTP time of the Unix epoch, in seconds.
+	ntpOffset = 2208988800
+
+	// maxTimecodeDelay is the furthest in the future a timecode
+	// is honored.  Later ones mean the clocks disagree, and the
+	// frame is shown at once.
+	maxTimecodeDelay = 2 * time.Second
+)
+
+type Receiver struct {
+	conn *net.UDPConn
+	in   *image.RGBA
+	wg   sync.WaitGroup
+
+	// Pushes with a timecode are held until due, which is nil
+	// when nothing is held.
+	held    *image.RGBA
+	pending bool
+	due     <-chan time.Time
+	now     func() time.Time
+
+	// The decoder fills in, then publishes it to the Buffer (by
+	// way of held, when timed) on each push.
+	*frame.Buffer
+}
+
+// NewReceiver returns a Receiver of frames the size of out, listening
+// at hostIP.
+func NewReceiver(hostIP string, out *image.RGBA) (*Receiver, error) {
+	src := fmt.Sprintf("%s:%d", hostIP, Port)
+	localAddr, _ := net.ResolveUDPAddr("udp", src)
+
+	conn, err := net.ListenUDP("udp", localAddr)
+	if err != nil {
+		fmt.Printf("error opening udp: %s\n", err)
+		return nil, err
+	}
+	return newReceiver(conn, out), nil
+}
+
+func newReceiver(conn *net.UDPConn, out *image.RGBA) *Receiver {
+	return &Receiver{
+		conn:   conn,
+		in:     image.NewRGBA(out.Bounds()),
+		held:   image.NewRGBA(out.Bounds()),
+		now:    time.Now,
+		Buffer: frame.NewBuffer(out),
+	}
+}
+
+// datagram is a packet and its source.
+type datagram struct {
+	b    []byte
+	from *net.UDPAddr
+}
+
+func (r *Receiver) Start(ctx context.Context) error {
+	recvCh := make(chan datagram, receiverQueueLen)
+	r.wg.Add(2)
+
+	go func() {
+		defer r.wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, from, err := r.conn.ReadFromUDP(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				fmt.Printf("error reading packet: %s\n", err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case recvCh <- datagram{buf[:n], from}:
+				buf = make([]byte, maxPacketSize)
+			}
+		}
+	}()
+
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d := <-recvCh:
+				r.handle(d.b, d.from)
+			case <-r.due:
+				r.release()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// handle decodes one packet, answering the sender if it asks.
+func (r *Receiver) handle(b []byte, from *net.UDPAddr) {
+	if len(b) < headerSize {
+		fmt.Printf("ddp: short packet: %d bytes\n", len(b))
+		return
+	}
+	flags := b[0]
+	if flags&versionMask != flagVersion {
+		fmt.Printf("ddp: unknown version %#x\n", flags&versionMask)
+		return
+	}
+	if flags&flagReply != 0 {
+		return
+	}
+	id := b[3]
+	offset := binary.BigEndian.Uint32(b[4:])
+	length := int(binary.BigEndian.Uint16(b[8:]))
+
+	data := b[headerSize:]
+	var timecode uint32
+	if flags&flagTimecode != 0 {
+		if len(data) < timecodeSize {
+			fmt.Printf("ddp: short packet: %d bytes\n", len(b))
+			return
+		}
+		timecode = binary.BigEndian.Uint32(data)
+		data = data[timecodeSize:]
+	}
+	if length > len(data) {
+		fmt.Printf("ddp: %d bytes of data, header says %d\n", len(data), length)
+		return
+	}
+	data = data[:length]
+
+	if flags&flagQuery != 0 {
+		r.query(id, from)
+		return
+	}
+	if id != idDisplay && id != idAll {
+		return
+	}
+	switch t := b[2]; t {
+	case typeUndefined, typeRGBLegacy, typeRGB8:
+	default:
+		fmt.Printf("ddp: unsupported data type %#x\n", t)
+		return
+	}
+
+	r.pixels(offset, data)
+
+	if flags&flagPush != 0 {
+		r.push(flags&flagTimecode != 0, timecode)
+	}
+}
+
+// pixels places RGB data starting at a byte offset in the frame.
+// Data beyond the frame is ignored.  The offset is compared before
+// conversion, since it may not fit in an int on 32-bit hosts.
+func (r *Receiver) pixels(offset uint32, data []byte) {
+	pix := r.in.Pix
+	channels := 3 * (len(pix) / 4)
+	if uint64(offset) >= uint64(channels) {
+		return
+	}
+	start := int(offset)
+	if n := channels - start; len(data) > n {
+		data = data[:n]
+	}
+	for i, v := range data {
+		c := start + i
+		pix[c/3*4+c%3] = v
+	}
+}
+
+// push completes a frame, publishing it now or at its timecode.
+func (r *Receiver) push(timed bool, timecode uint32) {
+	var delay time.Duration
+	if timed {
+		delay = r.delay(timecode)
+	}
+	if r.pending {
+		// Show the previous frame on time or late, not never.
+		r.release()
+	}
+	if delay <= 0 {
+		// Senders may update part of a frame, so the next
+		// starts as a copy of this one.
+		done := r.in
+		r.in = r.Publish(done)
+		copy(r.in.Pix, done.Pix)
+		return
+	}
+	r.in, r.held = r.held, r.in
+	copy(r.in.Pix, r.held.Pix)
+	r.pending = true
+	r.due = time.After(delay)
+}
+
+// release publishes the held frame.
+func (r *Receiver) release() {
+	if r.pending {
+		r.held = r.Publish(r.held)
+		r.pending = false
+	}
+	r.due = nil
+}
+
+// delay returns the time until a timecode, which is the low 16 bits
+// of the seconds of NTP time and 16 bits of fraction.  Timecodes in
+// the past, or too far in the future, have no delay.
+func (r *Receiver) delay(timecode uint32) time.Duration {
+	now := r.now()
+	sec := uint32(now.Unix() + ntpOffset)
+	frac := uint32(uint64(now.Nanosecond()) << 16 / uint64(time.Second))
+	d := time.Duration(int32(timecode-(sec<<16|frac))) * time.Second >> 16
+	if d > maxTimecodeDelay {
+		return 0
+	}
+	return d
+}
+
+// status and config are the JSON answers to queries.
+type (
+	status struct {
+		Status struct {
+			Manufacturer string `json:"man"`
+			Model        string `json:"mod"`
+			Version      string `json:"ver"`
+			Push         bool   `json:"push"`
+		} `json:"status"`
+	}
+	config struct {
+		Config struct {
+			Ports []port `json:"ports"`
+		} `json:"config"`
+	}
+	port struct {
+		Port   int `json:"port"`
+		Pixels int `json:"l"`
+	}
+)
+
+// query answers a request for status or configuration.
+func (r *Receiver) query(id byte, from *net.UDPAddr) {
+	var v any
+	switch id {
+	case idStatus:
+		var s status
+		s.Status.Manufacturer = "nerve"
+		s.Status.Model = "ledctrl"
+		s.Status.Version = "1"
+		s.Status.Push = true
+		v = s
+	case idConfig:
+		var c config
+		c.Config.Ports = []port{{Port: 0, Pixels: len(r.in.Pix) / 4}}
+		v = c
+	default:
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("ddp: %v\n", err)
+		return
+	}
+	b := make([]byte, headerSize+len(data))
+	b[0] = flagVersion | flagReply | flagPush
+	b[3] = id
+	binary.BigEndian.PutUint16(b[8:], uint16(len(data)))
+	copy(b[headerSize:], data)
+	if _, err := r.conn.WriteToUDP(b, from); err != nil {
+		fmt.Printf("ddp: reply: %v\n", err)
+	}
+}
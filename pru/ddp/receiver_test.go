@@ -0,0 +1,181 @@
+package ddp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// chunk is the data per packet, as WLED and xLights send.
+const chunk = 1440
+
+func packet(flags byte, offset int, data []byte, timecode uint32) []byte {
+	b := make([]byte, headerSize, headerSize+timecodeSize+len(data))
+	b[0] = flagVersion | flags
+	b[2] = typeRGB8
+	b[3] = idDisplay
+	binary.BigEndian.PutUint32(b[4:], uint32(offset))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(data)))
+	if flags&flagTimecode != 0 {
+		b = binary.BigEndian.AppendUint32(b, timecode)
+	}
+	return append(b, data...)
+}
+
+// framePackets sends img in chunks, pushing with the last.
+func framePackets(img *image.RGBA, flags byte, timecode uint32) (pkts [][]byte) {
+	var rgb []byte
+	for i := 0; i < len(img.Pix); i += 4 {
+		rgb = append(rgb, img.Pix[i:i+3]...)
+	}
+	for off := 0; off < len(rgb); off += chunk {
+		end := off + chunk
+		f := byte(0)
+		if end >= len(rgb) {
+			end = len(rgb)
+			f = flags | flagPush
+		}
+		pkts = append(pkts, packet(f, off, rgb[off:end], timecode))
+	}
+	return pkts
+}
+
+func randomImage(seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0
+	}
+	return img
+}
+
+func TestReceiverPush(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out)
+
+	src := randomImage(1)
+	pkts := framePackets(src, 0, 0)
+	for _, b := range pkts[:len(pkts)-1] {
+		r.handle(b, nil)
+	}
+	if seq := r.Sequence(); seq != 0 {
+		t.Fatalf("frame before push: sequence %d", seq)
+	}
+	r.handle(pkts[len(pkts)-1], nil)
+	if seq := r.Draw(); seq != 1 || string(out.Pix) != string(src.Pix) {
+		t.Fatalf("pushed frame: sequence %d", seq)
+	}
+
+	// A push may update part of the frame.
+	for i := 0; i < 2; i++ {
+		r.handle(packet(flagPush, 3, []byte{1, 2, 3}, 0), nil)
+		copy(src.Pix[4:7], []byte{1, 2, 3})
+		if seq := r.Draw(); seq != uint64(i+2) || string(out.Pix) != string(src.Pix) {
+			t.Fatalf("partial update: sequence %d", seq)
+		}
+	}
+
+	// Data past the frame is ignored, including at offsets
+	// beyond the range of a 32-bit int.
+	r.handle(packet(flagPush, len(src.Pix), []byte{1, 2, 3}, 0), nil)
+	if seq := r.Draw(); seq != 4 || string(out.Pix) != string(src.Pix) {
+		t.Fatalf("past the frame: sequence %d", seq)
+	}
+	for i, offset := range []uint32{0x80000000, 0xfffffffe} {
+		b := packet(flagPush, 0, []byte{1, 2, 3}, 0)
+		binary.BigEndian.PutUint32(b[4:], offset)
+		r.handle(b, nil)
+		if seq := r.Draw(); seq != uint64(5+i) || string(out.Pix) != string(src.Pix) {
+			t.Fatalf("offset %#x: sequence %d", offset, seq)
+		}
+	}
+}
+
+func TestReceiverTimecode(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out)
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	// NTP 16.16 time, modulo 2^16 seconds.
+	at := func(d time.Duration) uint32 {
+		sec := uint32(now.Unix()+ntpOffset) << 16
+		return sec + uint32(d*(1<<16)/time.Second)
+	}
+
+	// A frame for the future is held until due.
+	src := randomImage(1)
+	for _, b := range framePackets(src, flagTimecode, at(500*time.Millisecond)) {
+		r.handle(b, nil)
+	}
+	if r.Sequence() != 0 || r.due == nil {
+		t.Fatal("timed frame not held")
+	}
+	r.release()
+	if seq := r.Draw(); seq != 1 || string(out.Pix) != string(src.Pix) {
+		t.Fatalf("timed frame: sequence %d", seq)
+	}
+
+	// Frames for the past, or too far ahead, are shown at once.
+	for i, d := range []time.Duration{-time.Second, time.Hour} {
+		src = randomImage(int64(i + 2))
+		for _, b := range framePackets(src, flagTimecode, at(d)) {
+			r.handle(b, nil)
+		}
+		if seq := r.Draw(); seq != uint64(i+2) || string(out.Pix) != string(src.Pix) {
+			t.Fatalf("timecode %v: sequence %d", d, seq)
+		}
+	}
+
+	// A held frame is shown when the next arrives.
+	held := randomImage(4)
+	for _, b := range framePackets(held, flagTimecode, at(time.Second)) {
+		r.handle(b, nil)
+	}
+	for _, b := range framePackets(randomImage(5), flagTimecode, at(time.Second)) {
+		r.handle(b, nil)
+	}
+	if seq := r.Draw(); seq != 4 || string(out.Pix) != string(held.Pix) {
+		t.Fatalf("replaced timed frame: sequence %d", seq)
+	}
+}
+
+func TestReceiverQuery(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := newReceiver(conn, image.NewRGBA(image.Rect(0, 0, 32, 16)))
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	q := packet(flagQuery, 0, nil, 0)
+	q[3] = idConfig
+	r.handle(q, client.LocalAddr().(*net.UDPAddr))
+
+	buf := make([]byte, maxPacketSize)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf[0] != flagVersion|flagReply|flagPush || buf[3] != idConfig {
+		t.Fatalf("reply header % x", buf[:headerSize])
+	}
+	var c config
+	if err := json.Unmarshal(buf[headerSize:n], &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Config.Ports) != 1 || c.Config.Ports[0].Pixels != 32*16 {
+		t.Errorf("config %+v", c)
+	}
+}
@@ -0,0 +1,136 @@
+// Package frame passes complete frames from a network receiver to
+// the encoder.
+package frame
+
+import (
+	"context"
+	"image"
+	"sync"
+)
+
+// Buffer holds the latest complete frame.  Frames are
+// double-buffered: the receiver fills one image without locking, then
+// swaps it with the complete frame by Publish.
+type Buffer struct {
+	out *image.RGBA
+
+	// mu protects the complete frame cpy, its sequence number,
+	// and notify, which is closed and replaced when a frame
+	// completes if waiting is set.
+	mu      sync.Mutex
+	cpy     *image.RGBA
+	seq     uint64
+	notify  chan struct{}
+	waiting bool
+
+	// frames holds the sequence number of the latest frame not
+	// yet received from Frames.
+	frames chan uint64
+}
+
+// NewBuffer returns a Buffer of frames the size of out, which Draw
+// and Next copy them to.
+func NewBuffer(out *image.RGBA) *Buffer {
+	return &Buffer{
+		out:    out,
+		cpy:    image.NewRGBA(out.Bounds()),
+		notify: make(chan struct{}),
+		frames: make(chan uint64, 1),
+	}
+}
+
+// Publish makes img the complete frame and returns the previous one,
+// to be filled next.  The receiver must rewrite every pixel of a
+// frame before publishing it, so that it may reuse the buffer.
+func (b *Buffer) Publish(img *image.RGBA) *image.RGBA {
+	b.mu.Lock()
+	img, b.cpy = b.cpy, img
+	b.seq++
+	seq := b.seq
+	if b.waiting {
+		close(b.notify)
+		b.notify = make(chan struct{})
+		b.waiting = false
+	}
+	b.mu.Unlock()
+
+	// Replace any sequence number not yet received.
+	select {
+	case <-b.frames:
+	default:
+	}
+	b.frames <- seq
+	return img
+}
+
+// Draw copies the latest complete frame to the output image and
+// returns its sequence number, which is zero until the first frame
+// completes.
+func (b *Buffer) Draw() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	copy(b.out.Pix, b.cpy.Pix)
+	return b.seq
+}
+
+// Sequence returns the sequence number of the latest complete frame.
+// Sequence numbers start at 1 and increase by one per frame.
+func (b *Buffer) Sequence() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Next waits for a complete frame with a sequence number after
+// the given one, then copies the latest to the output image and
+// returns its sequence number.
+func (b *Buffer) Next(ctx context.Context, after uint64) (uint64, error) {
+	for {
+		b.mu.Lock()
+		if b.seq > after {
+			copy(b.out.Pix, b.cpy.Pix)
+			seq := b.seq
+			b.mu.Unlock()
+			return seq, nil
+		}
+		notify := b.notify
+		b.waiting = true
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return after, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// Frames returns a channel that receives the sequence number of each
+// new complete frame.  When frames complete faster than they are
+// received, only the latest is kept.  Use Draw to copy it.
+func (b *Buffer) Frames() <-chan uint64 {
+	return b.frames
+}
+
+// Channels copies the channels of one DMX universe, width wide, into
+// the RGB channels of the pixels in pix, in row-major order.  Channel
+// 0 of the universe is channel k of the frame, where k may be
+// negative, and channels beyond the data are zero.
+func Channels(pix []byte, k, width int, data []byte) {
+	end := width
+	if frame := 3*(len(pix)/4) - k; end > frame {
+		end = frame
+	}
+	ch := 0
+	if k < 0 {
+		ch = -k
+	}
+	for ; ch < end; ch++ {
+		var v byte
+		if ch < len(data) {
+			v = data[ch]
+		}
+		c := k + ch
+		pix[c/3*4+c%3] = v
+	}
+}
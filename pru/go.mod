@@ -7,9 +7,15 @@ toolchain go1.21.3
 require (
 	fyne.io/fyne v1.4.3
 	github.com/fogleman/gg v1.3.0
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/jmacd/go-artnet v0.0.0-20220707060336-6bfd9f54a67f
+	github.com/jmacd/launchmidi v0.0.0-20231203073955-ae7df3ce652c
 	github.com/lucasb-eyer/go-colorful v1.2.0
 	gitlab.com/gomidi/midi/v2 v2.0.25
+	golang.org/x/image v0.6.0
+	golang.org/x/net v0.6.0
+	golang.org/x/sys v0.5.0
+	gonum.org/v1/gonum v0.14.0
 )
 
 require (
@@ -20,17 +26,11 @@ require (
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20200625191551-73d3c3675aa3 // indirect
 	github.com/godbus/dbus/v5 v5.0.3 // indirect
 	github.com/goki/freetype v0.0.0-20181231101311-fa8a33aabaff // indirect
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/jmacd/launchmidi v0.0.0-20231203073955-ae7df3ce652c // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/srwiley/oksvg v0.0.0-20200311192757-870daf9aa564 // indirect
 	github.com/srwiley/rasterx v0.0.0-20200120212402-85cb7272f5e9 // indirect
 	github.com/stretchr/testify v1.5.1 // indirect
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
-	golang.org/x/image v0.6.0 // indirect
-	golang.org/x/net v0.6.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
-	gonum.org/v1/gonum v0.14.0 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
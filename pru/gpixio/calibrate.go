@@ -0,0 +1,264 @@
+package gpixio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// levelBits is the fixed-point fraction of a calibrated level,
+	// below one PWM step, which dithering rounds.
+	levelBits = 8
+
+	// curveSize is the number of intervals in a calibration curve
+	// table, interpolated linearly.
+	curveSize = 1024
+)
+
+// Calibration corrects the color of one output or panel.  Each
+// channel's linear input is mixed by Matrix, then driven at
+// Gain * pow(mixed, Curve), clipped to full brightness.
+type Calibration struct {
+	Matrix [3][3]float64 `json:"matrix"`
+	Gain   [3]float64    `json:"gain"`
+	Curve  [3]float64    `json:"curve"`
+}
+
+// Identity is the Calibration that changes nothing.  Fields missing
+// from a profile file take their values from Identity.
+var Identity = Calibration{
+	Matrix: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+	Gain:   [3]float64{1, 1, 1},
+	Curve:  [3]float64{1, 1, 1},
+}
+
+func (c *Calibration) UnmarshalJSON(data []byte) error {
+	type plain Calibration
+	p := plain(Identity)
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = Calibration(p)
+	return nil
+}
+
+// Profile assigns a Calibration to outputs and panels, e.g.,
+//
+//	{
+//	  "outputs": {"J6": {"gain": [0.9, 1, 0.85]}},
+//	  "panels": {"J1.2": {"curve": [1.1, 1, 1]}}
+//	}
+//
+// Outputs are keyed J1 through J8.  Panels are keyed by output and
+// position in its chain, starting at 1 for the leftmost, and replace
+// the calibration of their output.  Anything not named is left as
+// Identity.
+type Profile struct {
+	Outputs map[string]Calibration `json:"outputs"`
+	Panels  map[string]Calibration `json:"panels"`
+}
+
+// ParseProfile reads a calibration profile.
+func ParseProfile(r io.Reader) (*Profile, error) {
+	var p Profile
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, err
+	}
+	for key := range p.Outputs {
+		if _, err := parseOutput(key); err != nil {
+			return nil, err
+		}
+	}
+	for key := range p.Panels {
+		if _, _, err := parsePanel(key); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// LoadProfile reads a calibration profile from a file.
+func LoadProfile(name string) (*Profile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ParseProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+	return p, nil
+}
+
+// parseOutput returns the 0-based output of a key like "J6".
+func parseOutput(key string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(key, "J"))
+	if err != nil || !strings.HasPrefix(key, "J") || n < 1 || n > maxOutputs {
+		return 0, fmt.Errorf("invalid output %q", key)
+	}
+	return n - 1, nil
+}
+
+// parsePanel returns the 0-based output and chain position of a key
+// like "J6.2".
+func parsePanel(key string) (output, panel int, _ error) {
+	out, pos, ok := strings.Cut(key, ".")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid panel %q", key)
+	}
+	output, err := parseOutput(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.Atoi(pos)
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("invalid panel %q", key)
+	}
+	return output, n - 1, nil
+}
+
+// Lookup returns the Calibration of a panel, by 0-based output and
+// chain position.
+func (p *Profile) Lookup(output, panel int) Calibration {
+	if c, ok := p.Panels[fmt.Sprintf("J%d.%d", output+1, panel+1)]; ok {
+		return c
+	}
+	if c, ok := p.Outputs[fmt.Sprintf("J%d", output+1)]; ok {
+		return c
+	}
+	return Identity
+}
+
+// SetProfile selects the calibration profile, applied to the image
+// before quantization.  The Curve passed to Copy0 and Copy1 still
+// applies first, as a global adjustment.  A nil profile turns
+// calibration off.  This must not be called concurrently with
+// encoding.
+func (b *Buffer) SetProfile(p *Profile) error {
+	if p == nil {
+		b.profile = nil
+		b.calibrators = nil
+		b.levels = nil
+		return nil
+	}
+	l := &b.layout
+	for key := range p.Outputs {
+		if output, _ := parseOutput(key); output >= l.Outputs {
+			return fmt.Errorf("%s is not in use", key)
+		}
+	}
+	for key := range p.Panels {
+		if output, panel, _ := parsePanel(key); output >= l.Outputs || panel >= l.Chain {
+			return fmt.Errorf("%s is not in use", key)
+		}
+	}
+
+	shared := map[Calibration]*calibrator{}
+	b.calibrators = make([]*calibrator, l.Outputs*l.Chain)
+	for output := 0; output < l.Outputs; output++ {
+		for panel := 0; panel < l.Chain; panel++ {
+			c := p.Lookup(output, panel)
+			if shared[c] == nil {
+				shared[c] = newCalibrator(c)
+			}
+			b.calibrators[output*l.Chain+panel] = shared[c]
+		}
+	}
+	b.profile = p
+	b.levels = make([]uint16, len(b.Pix))
+	return nil
+}
+
+// Profile returns the calibration profile, or nil.
+func (b *Buffer) Profile() *Profile {
+	return b.profile
+}
+
+// calibrator applies one Calibration.  Its curves include the gain
+// and are tabulated over the mixed value.
+type calibrator struct {
+	matrix [3][3]float32
+	curves [3][curveSize + 1]float32
+}
+
+func newCalibrator(c Calibration) *calibrator {
+	k := &calibrator{}
+	for i := range c.Matrix {
+		for j := range c.Matrix[i] {
+			k.matrix[i][j] = float32(c.Matrix[i][j])
+		}
+	}
+	for ch := range k.curves {
+		for i := range k.curves[ch] {
+			v := c.Gain[ch] * math.Pow(float64(i)/curveSize, c.Curve[ch])
+			k.curves[ch][i] = float32(math.Min(1, math.Max(0, v)))
+		}
+	}
+	return k
+}
+
+// apply maps linear input to calibrated drive, both in [0, 1].
+func (k *calibrator) apply(in [3]float32) (out [3]float32) {
+	for ch := range out {
+		m := k.matrix[ch][0]*in[0] + k.matrix[ch][1]*in[1] + k.matrix[ch][2]*in[2]
+		if m <= 0 {
+			continue
+		}
+		t := &k.curves[ch]
+		if m >= 1 {
+			out[ch] = t[curveSize]
+			continue
+		}
+		f := m * curveSize
+		i := int(f)
+		out[ch] = t[i] + (t[i+1]-t[i])*(f-float32(i))
+	}
+	return out
+}
+
+// calibrate fills levels from the image, panel by panel, in units of
+// 1<<levelBits per PWM step, for the dirty scan rows.  The levels of
+// other rows are left as they were, since they will not be encoded.
+func (b *Buffer) calibrate(dirty []bool) {
+	if b.profile == nil {
+		return
+	}
+	var linear [256]float32
+	for i := range linear {
+		linear[i] = float32(b.linear[i])
+	}
+	scale := float32(b.selected.scale) * float32(int(1)<<b.depth-1) * (1 << levelBits)
+
+	l := &b.layout
+	for output := 0; output < l.Outputs; output++ {
+		for panel := 0; panel < l.Chain; panel++ {
+			k := b.calibrators[output*l.Chain+panel]
+			x0 := (output/l.Stack)*l.Clocks() + panel*l.PanelWidth
+			y0 := (output % l.Stack) * l.PanelHeight
+
+			for y := y0; y < y0+l.PanelHeight; y++ {
+				if !dirty[(y-y0)%l.Scan] {
+					continue
+				}
+				o := y*b.Stride + 4*x0
+				for x := 0; x < l.PanelWidth; x++ {
+					d := k.apply([3]float32{
+						linear[b.Pix[o+0]],
+						linear[b.Pix[o+1]],
+						linear[b.Pix[o+2]],
+					})
+					b.levels[o+0] = uint16(d[0] * scale)
+					b.levels[o+1] = uint16(d[1] * scale)
+					b.levels[o+2] = uint16(d[2] * scale)
+					o += 4
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package gpixio
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile(strings.NewReader(`{
+		"outputs": {"J6": {"gain": [0.5, 1, 1]}},
+		"panels": {"J6.2": {"matrix": [[1, 0, 0], [0, 1, 0], [0, 0, 0.5]]}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j6 := Identity
+	j6.Gain[0] = 0.5
+	if got := p.Lookup(5, 0); got != j6 {
+		t.Errorf("J6.1: %v", got)
+	}
+	j62 := Identity
+	j62.Matrix[2][2] = 0.5
+	if got := p.Lookup(5, 1); got != j62 {
+		t.Errorf("J6.2: %v", got)
+	}
+	if got := p.Lookup(0, 0); got != Identity {
+		t.Errorf("J1.1: %v", got)
+	}
+
+	for _, bad := range []string{
+		`{"outputs": {"J9": {}}}`,
+		`{"outputs": {"6": {}}}`,
+		`{"panels": {"J6": {}}}`,
+		`{"panels": {"J6.0": {}}}`,
+	} {
+		if _, err := ParseProfile(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestCalibrationCopyEquivalence(t *testing.T) {
+	p, err := ParseProfile(strings.NewReader(`{
+		"outputs": {"J2": {"matrix": [[0.8, 0.2, 0], [0, 1, 0], [0.1, 0, 0.9]], "curve": [1.2, 1, 0.9]}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []Dither{DitherNone, DitherTemporal | DitherSpatial} {
+		b0 := NewBuffer()
+		b1 := NewBuffer()
+		for _, b := range []*Buffer{b0, b1} {
+			rand.New(rand.NewSource(4)).Read(b.Pix)
+			b.SetDither(d)
+			if err := b.SetProfile(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var fb0, fb1 FrameBank
+		b0.Copy0(Gamma(2.2), &fb0)
+		b1.Copy1(Gamma(2.2), &fb1)
+		if fb0 != fb1 {
+			t.Fatalf("dither %d: Copy0 and Copy1 differ", d)
+		}
+	}
+}
+
+func TestCalibrationGain(t *testing.T) {
+	l := Layout{
+		PanelWidth:  64,
+		PanelHeight: 32,
+		Scan:        16,
+		Chain:       2,
+		Outputs:     2,
+		Stack:       2,
+	}
+	b, err := NewBufferLayout(l, Octoscroller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetProfile(&Profile{
+		Outputs: map[string]Calibration{
+			"J2": {Matrix: Identity.Matrix, Gain: [3]float64{0.5, 1, 0.25}, Curve: Identity.Curve},
+		},
+		Panels: map[string]Calibration{
+			"J2.2": Identity,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The bank holds 128 frames of this layout.
+	if err := b.SetDepth(7); err != nil {
+		t.Fatal(err)
+	}
+	draw.Draw(b.RGBA, b.Bounds(), image.NewUniform(color.RGBA{200, 200, 200, 255}), image.Point{}, draw.Src)
+
+	var fb FrameBank
+	b.Copy1(Gamma(1), &fb)
+	dec := b.Decode(&fb)
+
+	// J1 is the upper row, J2 the lower; each chains two panels.
+	for _, test := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{198, 198, 198, 255}},
+		{64, 0, color.RGBA{198, 198, 198, 255}},
+		{0, 32, color.RGBA{98, 198, 48, 255}},
+		{64, 32, color.RGBA{198, 198, 198, 255}},
+	} {
+		if got := dec.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("(%d, %d): decoded %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	if err := b.SetProfile(&Profile{Panels: map[string]Calibration{"J2.3": Identity}}); err == nil {
+		t.Error("J2.3 is not in the layout")
+	}
+}
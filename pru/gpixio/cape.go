@@ -0,0 +1,283 @@
+package gpixio
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OctoscrollerCape and BBBPins name the embedded descriptors
+	// for the Octoscroller cape and the BeagleBone Black headers.
+	OctoscrollerCape = "capes/octoscroller.json"
+	BBBPins          = "capes/bbb-pins.csv"
+)
+
+//go:embed capes
+var CapeFS embed.FS
+
+// Octoscroller is the Pinout of the Octoscroller cape.
+var Octoscroller = func() *Pinout {
+	p, err := LoadPinout("", "")
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
+// GPIO identifies one bit of one of the four GPIO banks.
+type GPIO struct {
+	Bank int
+	Bit  int
+}
+
+type CapePin struct {
+	Pin  string `json:"pin"`
+	Type string `json:"type"`
+}
+
+type CapeOutput struct {
+	Pins map[string]string `json:"pins"`
+}
+
+// Cape is an FPP cape descriptor, as found in fpp/capes/bbb/panels.
+type Cape struct {
+	Name     string `json:"name"`
+	LongName string `json:"longName"`
+	PRU      int    `json:"pru"`
+	Timing   int    `json:"timing"`
+	Controls struct {
+		GPIO  int     `json:"gpio"`
+		Latch CapePin `json:"latch"`
+		OE    CapePin `json:"oe"`
+		Clock CapePin `json:"clock"`
+		Sel0  CapePin `json:"sel0"`
+		Sel1  CapePin `json:"sel1"`
+		Sel2  CapePin `json:"sel2"`
+		Sel3  CapePin `json:"sel3"`
+		Sel4  CapePin `json:"sel4"`
+	} `json:"controls"`
+	Outputs []CapeOutput `json:"outputs"`
+}
+
+// colorBit places one color channel of one position in a GPIO word.
+type colorBit struct {
+	pos     int // J1_1 through J8_2
+	channel int // 0, 1, 2 for red, green, blue
+	bit     int
+}
+
+// Pinout is the assignment of cape outputs and row-select lines to
+// GPIO bits, from which the encoder builds each DoublePixel.
+type Pinout struct {
+	Name string
+
+	// outputs is the number of HUB75 connectors.
+	outputs int
+
+	// colors lists the color bits of each GPIO bank.
+	colors [4][]colorBit
+
+	// sources is the inverse of colors, giving 3*pos+channel for
+	// each bit of each GPIO bank, or -1 where there is none.
+	sources [4][32]int8
+
+	// rowSelect lists the address lines, least significant first.
+	rowSelect []GPIO
+}
+
+// ParsePins reads a BeagleBone pin table, returning the GPIO for
+// each header pin named in the FPP style, e.g., "P8-07".
+func ParsePins(r io.Reader) (map[string]GPIO, error) {
+	pin2gpio := map[string]GPIO{}
+
+	pins, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+	for _, row := range pins {
+		if len(row) < 10 {
+			return nil, fmt.Errorf("short row: %v", row)
+		}
+		ps := row[0]
+		gs := row[9]
+		if !strings.HasPrefix(gs, "gpio") {
+			continue
+		}
+		pinAdd := 0
+		if strings.HasSuffix(ps, ".1") {
+			ps = ps[:len(ps)-2]
+			// This +50 convention is used in the fpp config file.
+			pinAdd = 50
+		}
+		if len(ps) < 4 {
+			return nil, fmt.Errorf("invalid pin: %s", ps)
+		}
+		hdr := ps[:2]
+		pinNum, err := strconv.Atoi(ps[3:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin: %s", ps)
+		}
+		pin := fmt.Sprintf("%s-%02d", hdr, pinNum+pinAdd)
+
+		if len(gs) < 7 {
+			return nil, fmt.Errorf("invalid gpio: %s", gs)
+		}
+		bank := int(gs[4] - '0')
+		if bank < 0 || bank > 3 {
+			return nil, fmt.Errorf("invalid gpio: %s", gs)
+		}
+		bit, err := strconv.Atoi(gs[6:])
+		if err != nil || bit < 0 || bit > 31 {
+			return nil, fmt.Errorf("invalid gpio: %s", gs)
+		}
+
+		pin2gpio[pin] = GPIO{
+			Bank: bank,
+			Bit:  bit,
+		}
+	}
+	return pin2gpio, nil
+}
+
+// ParseCape reads an FPP cape descriptor.
+func ParseCape(r io.Reader) (*Cape, error) {
+	var c Cape
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// NewPinout resolves the pins of a cape to GPIO bits.
+func NewPinout(c *Cape, pins map[string]GPIO) (*Pinout, error) {
+	if len(c.Outputs) > maxOutputs {
+		return nil, fmt.Errorf("%s: too many outputs: %d", c.Name, len(c.Outputs))
+	}
+	p := &Pinout{
+		Name:    c.Name,
+		outputs: len(c.Outputs),
+	}
+	for bank := range p.sources {
+		for bit := range p.sources[bank] {
+			p.sources[bank][bit] = -1
+		}
+	}
+	used := map[GPIO]string{}
+	use := func(g GPIO, what string) error {
+		if other, ok := used[g]; ok {
+			return fmt.Errorf("%s: gpio%d/%d used by %s and %s", c.Name, g.Bank, g.Bit, other, what)
+		}
+		used[g] = what
+		return nil
+	}
+
+	for i, sel := range []CapePin{
+		c.Controls.Sel0,
+		c.Controls.Sel1,
+		c.Controls.Sel2,
+		c.Controls.Sel3,
+		c.Controls.Sel4,
+	} {
+		if sel.Type != "gpio" || sel.Pin == "" {
+			break
+		}
+		g, ok := pins[sel.Pin]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown pin: sel%d: %s", c.Name, i, sel.Pin)
+		}
+		if err := use(g, fmt.Sprint("sel", i)); err != nil {
+			return nil, err
+		}
+		p.rowSelect = append(p.rowSelect, g)
+	}
+
+	for i, output := range c.Outputs {
+		for half := 0; half < 2; half++ {
+			for channel, color := range "rgb" {
+				which := fmt.Sprintf("%c%d", color, half+1)
+				pin, ok := output.Pins[which]
+				if !ok {
+					return nil, fmt.Errorf("%s: J%d has no %s pin", c.Name, i+1, which)
+				}
+				g, ok := pins[pin]
+				if !ok {
+					return nil, fmt.Errorf("%s: unknown pin: J%d-%s: %s", c.Name, i+1, which, pin)
+				}
+				if err := use(g, fmt.Sprintf("J%d-%s", i+1, which)); err != nil {
+					return nil, err
+				}
+				p.colors[g.Bank] = append(p.colors[g.Bank], colorBit{
+					pos:     2*i + half,
+					channel: channel,
+					bit:     g.Bit,
+				})
+				p.sources[g.Bank][g.Bit] = int8(3*(2*i+half) + channel)
+			}
+		}
+	}
+	return p, nil
+}
+
+// LoadPinout reads a cape descriptor and pin table from files.  An
+// empty name selects the embedded Octoscroller descriptor or
+// BeagleBone Black pin table.
+func LoadPinout(capeFile, pinFile string) (*Pinout, error) {
+	cf, err := OpenFile(capeFile, OctoscrollerCape)
+	if err != nil {
+		return nil, err
+	}
+	defer cf.Close()
+	c, err := ParseCape(cf)
+	if err != nil {
+		return nil, fmt.Errorf("parse cape: %w", err)
+	}
+
+	pf, err := OpenFile(pinFile, BBBPins)
+	if err != nil {
+		return nil, err
+	}
+	defer pf.Close()
+	pins, err := ParsePins(pf)
+	if err != nil {
+		return nil, fmt.Errorf("parse pins: %w", err)
+	}
+	return NewPinout(c, pins)
+}
+
+// OpenFile opens the named file, or if name is empty, the embedded
+// file of CapeFS, e.g., OctoscrollerCape.
+func OpenFile(name, embedded string) (io.ReadCloser, error) {
+	if name == "" {
+		return CapeFS.Open(embedded)
+	}
+	return os.Open(name)
+}
+
+// Outputs is the number of HUB75 connectors on the cape.
+func (p *Pinout) Outputs() int {
+	return p.outputs
+}
+
+// MaxScan is the largest scan the row-select lines can address.
+func (p *Pinout) MaxScan() int {
+	return 1 << len(p.rowSelect)
+}
+
+// rowSelectWords returns the GPIO words that address rowSel.
+func (p *Pinout) rowSelectWords(rowSel, scan int) (w [4]uint32) {
+	// TODO The following works, i.e., subtracting one from the
+	// rowSel.  why?
+	addr := (rowSel + scan - 1) % scan
+	for i, g := range p.rowSelect {
+		if addr&(1<<i) != 0 {
+			w[g.Bank] |= 1 << g.Bit
+		}
+	}
+	return w
+}
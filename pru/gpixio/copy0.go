@@ -1,9 +1,9 @@
 package gpixio
 
 import (
+	"fmt"
 	"image"
-	"math"
-	"math/bits"
+	"sync"
 )
 
 type (
@@ -39,41 +39,100 @@ const (
 	J8_2 = 15
 )
 
-func degammaSix(gamma float64) [256]uint8 {
-	var d6 [256]uint8
-	for i := range d6 {
-		d6[i] = uint8(255*math.Pow(float64(i)/255, gamma)) >> 2
+// degamma maps each 8-bit input through scale times the curve c
+// to a value of depth bits.
+func degamma(c Curve, scale float64, depth int) [256]uint16 {
+	var d [256]uint16
+	for i := range d {
+		d[i] = uint16(uint8(255*scale*c.Linear(uint8(i))) >> (8 - depth))
 	}
-	return d6
+	return d
 }
 
-var sixBitPatterns [64]uint64 = func() [64]uint64 {
-	var patterns [64]uint64
-	for i := 1; i < 64; i++ {
-		var p uint64
-		stride := 64 / float64(i)
-		offset := 0.0
-		for j := 0; j < i; j++ {
-			p |= 1 << int64(offset)
-			offset += stride
-		}
-		patterns[i] = p
-		if bits.OnesCount64(p) != i {
-			panic("bad logic")
-		}
-	}
-	return patterns
-}()
-
 type Buffer struct {
 	*image.RGBA
+
+	layout Layout
+	pins   *Pinout
+	depth  int
+	dither Dither
+
+	// encodes counts calls to Copy0 and Copy1, for temporal
+	// dithering across banks.
+	encodes uint64
+
+	// selected is what linear, tables and thresholds were last
+	// built from, and linear is the selected Curve.
+	selected selection
+	linear   [256]float64
+
+	// tables maps 8-bit input to PWM values for each temporal
+	// phase and spatial cell of the dither pattern.  Without
+	// dithering, only the first is used.
+	tables [temporalPhases * spatialCells][256]uint16
+
+	// thresholds is the dither threshold of each phase and cell,
+	// in units of 1<<levelBits per PWM step.
+	thresholds [temporalPhases * spatialCells]uint16
+
+	// profile, when set, calibrates the image into levels before
+	// quantization, one calibrator per panel.
+	profile     *Profile
+	calibrators []*calibrator
+	levels      []uint16
+
+	// banks remembers what each recently used FrameBank holds.
+	banks map[*FrameBank]*bankState
+
+	// limit configures the power estimate, and scale is the
+	// brightness the limiter allows.  ceiling, if not zero, is the
+	// lowest encoded brightness at which the unchanged image
+	// exceeded the limit.
+	limit   PowerLimit
+	scale   float64
+	ceiling float64
+	powerMu sync.Mutex
+	power   Power
 }
 
+// NewBuffer returns a Buffer for the DefaultLayout on the Octoscroller.
 func NewBuffer() *Buffer {
-	img := image.NewRGBA(image.Rect(0, 0, 128, 128))
-	return &Buffer{
-		RGBA: img,
+	b, err := NewBufferLayout(DefaultLayout, Octoscroller)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// NewBufferLayout returns a Buffer sized for the panels in l, wired
+// through the cape described by pins.
+func NewBufferLayout(l Layout, pins *Pinout) (*Buffer, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	if l.Outputs > pins.Outputs() {
+		return nil, fmt.Errorf("%s has %d outputs, need %d", pins.Name, pins.Outputs(), l.Outputs)
+	}
+	if l.Scan > pins.MaxScan() {
+		return nil, fmt.Errorf("%s addresses at most 1/%d scan", pins.Name, pins.MaxScan())
 	}
+	img := image.NewRGBA(image.Rect(0, 0, l.Width(), l.Height()))
+	return &Buffer{
+		RGBA:   img,
+		layout: l,
+		pins:   pins,
+		depth:  fitDepth(l.FramesPerBank()),
+		scale:  1,
+		power: Power{
+			Outputs: make([]float64, l.Outputs),
+			Scale:   1,
+		},
+	}, nil
+}
+
+// Layout returns the panel layout of this Buffer.
+func (b *Buffer) Layout() Layout {
+	return b.layout
 }
 
 type frameBits [16]uint64
@@ -85,24 +144,47 @@ func (f *frameBits) choose(position, frame, bit int) uint32 {
 	return 1 << bit
 }
 
-func pixelOffsetFor0(rowSel, rowQuad, pos int) int {
-	panelX := pos / 8
-	panelY := pos % 8
-
-	pixY := (panelY * 16) + rowSel
-	pixX := (panelX * 64) + (rowQuad * 16)
+// encode runs one encoding of the image into fb with copy, again at
+// the lower brightness set by the power limiter for as long as the
+// bank would exceed the limit, so that no bank displayed does.
+func (b *Buffer) encode(curve Curve, fb *FrameBank, copy func(fb *FrameBank, st *bankState, cycles int)) {
+	b.encodes++
+	for {
+		cycles := b.prepare(curve)
+		st := b.track(fb)
+		b.calibrate(st.dirty)
+		copy(fb, st, cycles)
+		if b.account(st, cycles) {
+			st.repeat(&b.layout, fb.pixels(), cycles<<b.depth, b.layout.cycleFrames(b.depth))
+			return
+		}
+	}
+}
 
-	return 4 * (128*pixY + pixX)
+func (b *Buffer) Copy0(curve Curve, fb *FrameBank) {
+	b.encode(curve, fb, b.copy0)
 }
 
-func (b *Buffer) Copy0(gamma float64, fb *FrameBank) {
-	degamma := degammaSix(gamma)
-	for rowSel := 0; rowSel < 16; rowSel++ {
+func (b *Buffer) copy0(fb *FrameBank, st *bankState, cycles int) {
+	pats := pwmPatterns[b.depth]
+	groups, groupFrames := b.groups(), b.groupFrames()
+	l := &b.layout
+	clocks := l.Clocks()
+	dps := fb.pixels()
+
+	for rowSel := 0; rowSel < l.Scan; rowSel++ {
+		if !st.dirty[rowSel] {
+			continue
+		}
+		rowSelect := b.pins.rowSelectWords(rowSel, l.Scan)
+		rowLit := &st.lit[rowSel]
+		*rowLit = [maxOutputs]int{}
 
-		for rowQuad := 0; rowQuad < 4; rowQuad++ {
+		for rowQuad := 0; rowQuad < clocks/runLength; rowQuad++ {
 
-			// This loop activates 64 times, each time
-			// constructing 768 bytes in three arrays.
+			// This loop activates 64 times (in the
+			// DefaultLayout), each time constructing 768
+			// bytes in three arrays.
 			//
 			//   64*768 == 3*(2**14)
 
@@ -110,15 +192,20 @@ func (b *Buffer) Copy0(gamma float64, fb *FrameBank) {
 			var G [16][16]byte
 			var B [16][16]byte
 
-			// Here, step through 2 positions per panel
-			// for 8 panels to yield 16 runs of 16 RGB
-			// pixels.
-			for pos := 0; pos < 16; pos++ {
+			// The offset and dither cell of each position's row.
+			var offsets, cells [16]int
+
+			// Here, step through 2 positions per output
+			// for up to 8 outputs to yield 16 runs of 16
+			// RGB pixels.  Unused outputs stay black.
+			for pos := 0; pos < 2*l.Outputs; pos++ {
 				pR := &R[pos]
 				pG := &G[pos]
 				pB := &B[pos]
 
-				pixOffset := pixelOffsetFor0(rowSel, rowQuad, pos)
+				pixOffset := l.pixelOffset(b.Stride, rowSel, rowQuad*runLength, pos)
+				offsets[pos] = pixOffset
+				cells[pos] = pixOffset / b.Stride % 4 * 4
 
 				// Gruesome: the next loop should be
 				// done by a NEON 4-way extract
@@ -142,100 +229,82 @@ func (b *Buffer) Copy0(gamma float64, fb *FrameBank) {
 			// The first dimension 16 pixels have the same row
 			// selector & pixel number.  Each group translates into
 			// 64-frame time slices (using 6 of 8 bits per color
-			// channel), 16 bytes per timeslice. So, 16 adjacent
-			// pixels each produces 64 * 16 == 1024 bytes,
-			// generating a total of 16KiB output from the input 768
-			// bytes.
+			// channel at the minimum depth), 16 bytes per
+			// timeslice. So, 16 adjacent pixels each produces 64 *
+			// 16 == 1024 bytes, generating a total of 16KiB output
+			// from the input 768 bytes.
 			//
 			// This loop body executes 64 times, yielding (64 *
 			// 16KiB == 1MiB) for 64 temporal frames across all
 			// pixels.  This is 1/8th of the frame buffer and
-			// approximately 1/32 seconds.
+			// approximately 1/32 seconds.  Greater depths
+			// repeat this for each additional 64 frames.
 
 			// For each of 16 pixels (across a row)
 			for p := 0; p < 16; p++ {
-				var reds frameBits
-				var greens frameBits
-				var blues frameBits
-
-				// For each of 16 pixels (scattered on the panel)
-				//
-				// Hmm, sixBitPatterns lookup can use NEON vqtbl4q_u8
-				// but not degammaSix.  Hmm?
-				for x := 0; x < 16; x++ {
-					reds[x] = sixBitPatterns[degamma[R[x][p]]]
-					greens[x] = sixBitPatterns[degamma[G[x][p]]]
-					blues[x] = sixBitPatterns[degamma[B[x][p]]]
-				}
+				// For each PWM cycle, which differ only
+				// when dithering in time.
+				for c := 0; c < cycles; c++ {
+					var vR, vG, vB [16]uint16
+
+					// For each of 16 pixels (scattered on the panel)
+					for x := 0; x < 2*l.Outputs; x++ {
+						if b.profile != nil {
+							o := offsets[x] + 4*p
+							vR[x] = b.level(o+0, c, cells[x]+p%4)
+							vG[x] = b.level(o+1, c, cells[x]+p%4)
+							vB[x] = b.level(o+2, c, cells[x]+p%4)
+							continue
+						}
+						deg := b.table(c, cells[x]+p%4)
+						vR[x] = deg[R[x][p]]
+						vG[x] = deg[G[x][p]]
+						vB[x] = deg[B[x][p]]
+					}
+
+					// Each value lights that many slices
+					// of its cycle.
+					for x := 0; x < 2*l.Outputs; x++ {
+						rowLit[x/2] += int(vR[x]) + int(vG[x]) + int(vB[x])
+					}
+
+					// For each group of 64 timeslices.
+					for q := 0; q < groups; q++ {
+						var reds frameBits
+						var greens frameBits
+						var blues frameBits
 
-				// For each of 64 timeslices.
-				for f := 0; f < 64; f++ {
-					dp := &fb[f][rowSel][p+rowQuad*16]
-
-					// Note: the code below is auto-generated by
-					// ../cmd/mkmap.  Except add
-					// uint32(rowSel)<<12, // Rowselect is bits 12:15
-					// to gpio1.
-					//
-					// TODO The following works, i.e., subtracting
-					// one from the rowSel.  why?
-					// (uint32((rowSel+15)%16) << 12)
-
-					dp.Gpio0 = blues.choose(J1_2, f, 26) |
-						reds.choose(J1_2, f, 23) |
-						reds.choose(J2_1, f, 27) |
-						blues.choose(J2_1, f, 22) |
-						reds.choose(J3_1, f, 30) |
-						blues.choose(J3_1, f, 31) |
-						greens.choose(J3_2, f, 3) |
-						blues.choose(J3_2, f, 5) |
-						blues.choose(J4_2, f, 4) |
-						reds.choose(J4_1, f, 2) |
-						greens.choose(J4_1, f, 15) |
-						greens.choose(J5_1, f, 11) |
-						blues.choose(J5_1, f, 10) |
-						reds.choose(J5_2, f, 9) |
-						greens.choose(J5_2, f, 8) |
-						greens.choose(J8_2, f, 14)
-					dp.Gpio1 = greens.choose(J3_1, f, 18) |
-						reds.choose(J3_2, f, 16) |
-						blues.choose(J4_1, f, 17) |
-						(uint32((rowSel+15)%16) << 12)
-					dp.Gpio2 = greens.choose(J1_2, f, 4) |
-						reds.choose(J1_1, f, 2) |
-						greens.choose(J1_1, f, 3) |
-						blues.choose(J1_1, f, 5) |
-						greens.choose(J2_1, f, 1) |
-						reds.choose(J2_2, f, 22) |
-						greens.choose(J2_2, f, 23) |
-						blues.choose(J2_2, f, 24) |
-						blues.choose(J5_2, f, 17) |
-						reds.choose(J5_1, f, 25) |
-						reds.choose(J6_1, f, 16) |
-						greens.choose(J6_1, f, 15) |
-						blues.choose(J6_1, f, 14) |
-						reds.choose(J6_2, f, 13) |
-						greens.choose(J6_2, f, 10) |
-						blues.choose(J6_2, f, 12) |
-						reds.choose(J7_1, f, 11) |
-						greens.choose(J7_1, f, 9) |
-						blues.choose(J7_1, f, 8) |
-						reds.choose(J7_2, f, 6) |
-						blues.choose(J7_2, f, 7)
-					dp.Gpio3 = reds.choose(J4_2, f, 21) |
-						greens.choose(J4_2, f, 19) |
-						greens.choose(J7_2, f, 18) |
-						reds.choose(J8_2, f, 14) |
-						blues.choose(J8_2, f, 20) |
-						reds.choose(J8_1, f, 17) |
-						greens.choose(J8_1, f, 16) |
-						blues.choose(J8_1, f, 15)
+						// Hmm, the pattern lookup can use NEON
+						// vqtbl4q_u8 but not degamma.  Hmm?
+						for x := 0; x < 16; x++ {
+							reds[x] = pats[int(vR[x])*groups+q]
+							greens[x] = pats[int(vG[x])*groups+q]
+							blues[x] = pats[int(vB[x])*groups+q]
+						}
+
+						chans := [3]*frameBits{&reds, &greens, &blues}
+
+						// For each of 64 timeslices.
+						for f := 0; f < groupFrames; f++ {
+							frame := c<<b.depth + q*slices + f
+							dp := &dps[(frame*l.Scan+rowSel)*clocks+p+rowQuad*runLength]
+
+							// Set each color bit named by the
+							// Pinout, on top of the row select.
+							w := rowSelect
+							for bank, cbs := range &b.pins.colors {
+								for _, cb := range cbs {
+									w[bank] |= chans[cb.channel].choose(cb.pos, f, cb.bit)
+								}
+							}
+							dp.Gpio0 = w[0]
+							dp.Gpio1 = w[1]
+							dp.Gpio2 = w[2]
+							dp.Gpio3 = w[3]
+						}
+					}
 				}
 			}
 		}
 	}
-
-	copy(fb[64:128], fb[0:64])
-	copy(fb[128:192], fb[0:64])
-	copy(fb[192:256], fb[0:64])
 }
@@ -1,12 +1,14 @@
 package gpixio
 
 import (
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/fogleman/gg"
 )
 
-func BenchmarkPlay(b *testing.B) {
+func benchmarkCopy(b *testing.B, copyFunc func(*Buffer, Curve, *FrameBank)) {
 	buf := NewBuffer()
 	dc := gg.NewContextForRGBA(buf.RGBA)
 
@@ -19,6 +21,150 @@ func BenchmarkPlay(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		buf.Copy0(&fb)
+		// Encode every row, not only the changed ones.
+		buf.Invalidate()
+		copyFunc(buf, Gamma(2.2), &fb)
+	}
+}
+
+func BenchmarkPlay(b *testing.B) {
+	benchmarkCopy(b, (*Buffer).Copy0)
+}
+
+func TestCopy0Octoscroller(t *testing.T) {
+	buf := NewBuffer()
+	rand.New(rand.NewSource(1)).Read(buf.Pix)
+
+	for _, gamma := range []float64{1, 2.2} {
+		var want, have FrameBank
+		buf.copy0Generated(gamma, &want)
+		buf.Copy0(Gamma(gamma), &have)
+
+		if want != have {
+			t.Errorf("gamma %v: table-driven encoding differs", gamma)
+		}
+	}
+}
+
+// degammaSix, sixBitPatterns, pixelOffsetFor0 and copy0Generated are
+// the Octoscroller encoder as it was before the Pinout, with tables
+// generated by ../cmd/mkmap.
+func degammaSix(gamma float64) [256]uint8 {
+	var d6 [256]uint8
+	for i := range d6 {
+		d6[i] = uint8(255*math.Pow(float64(i)/255, gamma)) >> 2
+	}
+	return d6
+}
+
+var sixBitPatterns [64]uint64 = func() [64]uint64 {
+	var patterns [64]uint64
+	for i := 1; i < 64; i++ {
+		var p uint64
+		stride := 64 / float64(i)
+		offset := 0.0
+		for j := 0; j < i; j++ {
+			p |= 1 << int64(offset)
+			offset += stride
+		}
+		patterns[i] = p
+	}
+	return patterns
+}()
+
+func pixelOffsetFor0(rowSel, rowQuad, pos int) int {
+	panelX := pos / 8
+	panelY := pos % 8
+
+	pixY := (panelY * 16) + rowSel
+	pixX := (panelX * 64) + (rowQuad * 16)
+
+	return 4 * (128*pixY + pixX)
+}
+
+func (b *Buffer) copy0Generated(gamma float64, fb *FrameBank) {
+	degamma := degammaSix(gamma)
+	for rowSel := 0; rowSel < 16; rowSel++ {
+		for rowQuad := 0; rowQuad < 4; rowQuad++ {
+			var R, G, B [16][16]byte
+
+			for pos := 0; pos < 16; pos++ {
+				pixOffset := pixelOffsetFor0(rowSel, rowQuad, pos)
+				for pix := 0; pix < 16; pix++ {
+					R[pos][pix] = b.Pix[pixOffset+0]
+					G[pos][pix] = b.Pix[pixOffset+1]
+					B[pos][pix] = b.Pix[pixOffset+2]
+					pixOffset += 4
+				}
+			}
+
+			for p := 0; p < 16; p++ {
+				var reds, greens, blues frameBits
+
+				for x := 0; x < 16; x++ {
+					reds[x] = sixBitPatterns[degamma[R[x][p]]]
+					greens[x] = sixBitPatterns[degamma[G[x][p]]]
+					blues[x] = sixBitPatterns[degamma[B[x][p]]]
+				}
+
+				for f := 0; f < 64; f++ {
+					dp := &fb[f][rowSel][p+rowQuad*16]
+
+					dp.Gpio0 = blues.choose(J1_2, f, 26) |
+						reds.choose(J1_2, f, 23) |
+						reds.choose(J2_1, f, 27) |
+						blues.choose(J2_1, f, 22) |
+						reds.choose(J3_1, f, 30) |
+						blues.choose(J3_1, f, 31) |
+						greens.choose(J3_2, f, 3) |
+						blues.choose(J3_2, f, 5) |
+						blues.choose(J4_2, f, 4) |
+						reds.choose(J4_1, f, 2) |
+						greens.choose(J4_1, f, 15) |
+						greens.choose(J5_1, f, 11) |
+						blues.choose(J5_1, f, 10) |
+						reds.choose(J5_2, f, 9) |
+						greens.choose(J5_2, f, 8) |
+						greens.choose(J8_2, f, 14)
+					dp.Gpio1 = greens.choose(J3_1, f, 18) |
+						reds.choose(J3_2, f, 16) |
+						blues.choose(J4_1, f, 17) |
+						(uint32((rowSel+15)%16) << 12)
+					dp.Gpio2 = greens.choose(J1_2, f, 4) |
+						reds.choose(J1_1, f, 2) |
+						greens.choose(J1_1, f, 3) |
+						blues.choose(J1_1, f, 5) |
+						greens.choose(J2_1, f, 1) |
+						reds.choose(J2_2, f, 22) |
+						greens.choose(J2_2, f, 23) |
+						blues.choose(J2_2, f, 24) |
+						blues.choose(J5_2, f, 17) |
+						reds.choose(J5_1, f, 25) |
+						reds.choose(J6_1, f, 16) |
+						greens.choose(J6_1, f, 15) |
+						blues.choose(J6_1, f, 14) |
+						reds.choose(J6_2, f, 13) |
+						greens.choose(J6_2, f, 10) |
+						blues.choose(J6_2, f, 12) |
+						reds.choose(J7_1, f, 11) |
+						greens.choose(J7_1, f, 9) |
+						blues.choose(J7_1, f, 8) |
+						reds.choose(J7_2, f, 6) |
+						blues.choose(J7_2, f, 7)
+					dp.Gpio3 = reds.choose(J4_2, f, 21) |
+						greens.choose(J4_2, f, 19) |
+						greens.choose(J7_2, f, 18) |
+						reds.choose(J8_2, f, 14) |
+						blues.choose(J8_2, f, 20) |
+						reds.choose(J8_1, f, 17) |
+						greens.choose(J8_1, f, 16) |
+						blues.choose(J8_1, f, 15)
+				}
+			}
+		}
 	}
+
+	copy(fb[64:128], fb[0:64])
+	copy(fb[128:192], fb[0:64])
+	copy(fb[192:256], fb[0:64])
 }
@@ -1,60 +1,115 @@
 package gpixio
 
-type residue [3]uint8 // R, G, B
-type residues [16]residue
-type intermediate [16][64]residues
-
-// func pixelOffsetFor1(x, y, pos int) int {
-// 	panelX := pos / 8
-// 	panelY := pos % 8
-// 	pixY := (panelY * 16) + y
-// 	pixX := (panelX * 64) + x
-// 	return 4 * (128*pixY + pixX)
-// }
-
-func cp(r *residue, p []byte, o int) {
-	// r[0] = p[o]
-	// r[1] = p[o+1]
-	// r[2] = p[o+2]
-	copy(r[:], p[o:o+3])
+// transpose32 transposes the 32x32 bit matrix a in place, where
+// element (i, j) is a[i]>>j&1.  This is the recursive block swap from
+// Hacker's Delight, 5 rounds of 16 exchanges.
+func transpose32(a *[32]uint32) {
+	m := uint32(0x0000ffff)
+	for j := 16; j != 0; {
+		for k := 0; k < 32; k = (k + j + 1) &^ j {
+			t := (a[k]>>j ^ a[k+j]) & m
+			a[k+j] ^= t
+			a[k] ^= t << j
+		}
+		j >>= 1
+		m ^= m << j
+	}
+}
+
+// Copy1 writes the same FrameBank as Copy0 by bit-slicing.  For each
+// DoublePixel, the PWM patterns of the (up to) 48 channels it
+// carries are gathered into GPIO-bit order, one row per bit of each
+// GPIO bank.  Transposing those rows yields the GPIO word of 64 time
+// slices at once, replacing Copy0's 64x48 bit tests with eight 32x32
+// transposes.
+func (b *Buffer) Copy1(curve Curve, fb *FrameBank) {
+	b.encode(curve, fb, b.copy1)
 }
 
-func (b *Buffer) Copy1(fb *FrameBank) {
-	var inter intermediate
-	var offset int
-
-	// 4 bytes/pix * 128 pix/row * 16 row/panel
-	ys := 4 * 128 * 16
-	xs := 4 * 64
-
-	pix := b.RGBA.Pix
-
-	// Gather into GPIO-pixel-order
-	for y := 0; y < 16; y++ {
-		row := &inter[y]
-
-		for x := 0; x < 64; x++ {
-			cp(&row[x][0], pix, offset+0*ys)
-			cp(&row[x][1], pix, offset+1*ys)
-			cp(&row[x][2], pix, offset+2*ys)
-			cp(&row[x][3], pix, offset+3*ys)
-			cp(&row[x][4], pix, offset+4*ys)
-			cp(&row[x][5], pix, offset+5*ys)
-			cp(&row[x][6], pix, offset+6*ys)
-			cp(&row[x][7], pix, offset+7*ys)
-
-			cp(&row[x][8], pix, offset+0*ys+xs)
-			cp(&row[x][9], pix, offset+1*ys+xs)
-			cp(&row[x][10], pix, offset+2*ys+xs)
-			cp(&row[x][11], pix, offset+3*ys+xs)
-			cp(&row[x][12], pix, offset+4*ys+xs)
-			cp(&row[x][13], pix, offset+5*ys+xs)
-			cp(&row[x][14], pix, offset+6*ys+xs)
-			cp(&row[x][15], pix, offset+7*ys+xs)
+func (b *Buffer) copy1(fb *FrameBank, st *bankState, cycles int) {
+	pats := pwmPatterns[b.depth]
+	groups, groupFrames := b.groups(), b.groupFrames()
+	l := &b.layout
+	clocks := l.Clocks()
+	dps := fb.pixels()
+	sources := &b.pins.sources
+
+	for rowSel := 0; rowSel < l.Scan; rowSel++ {
+		if !st.dirty[rowSel] {
+			continue
 		}
-	}
+		rowSelect := b.pins.rowSelectWords(rowSel, l.Scan)
+		rowLit := &st.lit[rowSel]
+		*rowLit = [maxOutputs]int{}
 
-	// Calculate 2K 16-position 3x1-bit values x 256 frames
-	for {
+		// The offset and dither cell of each position's row.
+		var offsets, cells [2 * maxOutputs]int
+		for pos := 0; pos < 2*l.Outputs; pos++ {
+			offsets[pos] = l.pixelOffset(b.Stride, rowSel, 0, pos)
+			cells[pos] = offsets[pos] / b.Stride % 4 * 4
+		}
+
+		for x := 0; x < clocks; x++ {
+			// For each PWM cycle, which differ only when
+			// dithering in time.
+			for c := 0; c < cycles; c++ {
+				// Gather into GPIO-pixel-order.  Unused
+				// positions stay zero, i.e., black.
+				var values [3 * 2 * maxOutputs]int
+				for pos := 0; pos < 2*l.Outputs; pos++ {
+					o := offsets[pos] + 4*x
+					if b.profile != nil {
+						values[3*pos+0] = int(b.level(o+0, c, cells[pos]+x%4)) * groups
+						values[3*pos+1] = int(b.level(o+1, c, cells[pos]+x%4)) * groups
+						values[3*pos+2] = int(b.level(o+2, c, cells[pos]+x%4)) * groups
+						continue
+					}
+					deg := b.table(c, cells[pos]+x%4)
+					values[3*pos+0] = int(deg[b.Pix[o+0]]) * groups
+					values[3*pos+1] = int(deg[b.Pix[o+1]]) * groups
+					values[3*pos+2] = int(deg[b.Pix[o+2]]) * groups
+				}
+
+				// Each value lights that many slices of
+				// its cycle.
+				for pos := 0; pos < 2*l.Outputs; pos++ {
+					rowLit[pos/2] += (values[3*pos+0] + values[3*pos+1] + values[3*pos+2]) / groups
+				}
+
+				for q := 0; q < groups; q++ {
+					// Calculate 64 time slices of each GPIO word.
+					var words [4][slices]uint32
+					for bank := range sources {
+						var lo, hi [32]uint32
+						var lit uint64
+						for bit, src := range &sources[bank] {
+							if src < 0 {
+								continue
+							}
+							p := pats[values[src]+q]
+							lo[bit] = uint32(p)
+							hi[bit] = uint32(p >> 32)
+							lit |= p
+						}
+						if lit == 0 {
+							continue
+						}
+						transpose32(&lo)
+						transpose32(&hi)
+						copy(words[bank][:32], lo[:])
+						copy(words[bank][32:], hi[:])
+					}
+
+					for f := 0; f < groupFrames; f++ {
+						frame := c<<b.depth + q*slices + f
+						dp := &dps[(frame*l.Scan+rowSel)*clocks+x]
+						dp.Gpio0 = words[0][f] | rowSelect[0]
+						dp.Gpio1 = words[1][f] | rowSelect[1]
+						dp.Gpio2 = words[2][f] | rowSelect[2]
+						dp.Gpio3 = words[3][f] | rowSelect[3]
+					}
+				}
+			}
+		}
 	}
 }
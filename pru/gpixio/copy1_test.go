@@ -0,0 +1,63 @@
+package gpixio
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTranspose32(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var a, orig [32]uint32
+	for i := range a {
+		a[i] = rnd.Uint32()
+	}
+	orig = a
+	transpose32(&a)
+
+	for i := 0; i < 32; i++ {
+		for j := 0; j < 32; j++ {
+			if orig[i]>>j&1 != a[j]>>i&1 {
+				t.Fatalf("element (%d, %d) not transposed", i, j)
+			}
+		}
+	}
+}
+
+func TestCopy1(t *testing.T) {
+	chained, err := NewBufferLayout(Layout{
+		PanelWidth:  32,
+		PanelHeight: 16,
+		Scan:        8,
+		Chain:       3,
+		Outputs:     5,
+		Stack:       3,
+	}, Octoscroller)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, buf := range []*Buffer{NewBuffer(), chained} {
+		rand.New(rand.NewSource(1)).Read(buf.Pix)
+
+		for depth := MinDepth; depth <= MaxDepth; depth++ {
+			if err := buf.SetDepth(depth); err != nil {
+				t.Fatal(err)
+			}
+			for _, gamma := range []float64{1, 2.2} {
+				var want, have FrameBank
+				buf.Copy0(Gamma(gamma), &want)
+				buf.Copy1(Gamma(gamma), &have)
+
+				if want != have {
+					t.Errorf("%v depth %d gamma %v: Copy1 differs from Copy0", buf.Layout(), depth, gamma)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkCopy1 encodes the same image as BenchmarkPlay, which
+// uses Copy0.
+func BenchmarkCopy1(b *testing.B) {
+	benchmarkCopy(b, (*Buffer).Copy1)
+}
@@ -0,0 +1,179 @@
+package gpixio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Curve is a transfer curve, mapping 8-bit input to the linear light
+// the panels should produce.  The encoder caches its tables for the
+// last Curve used, so implementations must be comparable with ==,
+// and equal Curves must be the same function.
+type Curve interface {
+	// Linear returns the light, in [0, 1], for input v.
+	Linear(v uint8) float64
+}
+
+// Gamma is the power law pow(v/255, gamma).
+type Gamma float64
+
+// Linear implements Curve.
+func (g Gamma) Linear(v uint8) float64 {
+	return math.Pow(float64(v)/255, float64(g))
+}
+
+func (g Gamma) String() string {
+	return fmt.Sprint("gamma ", float64(g))
+}
+
+// Adjust returns c raised to the power e, a global adjustment on top
+// of any curve, such as a gamma knob.  Adjust(c, 1) is c.
+func Adjust(c Curve, e float64) Curve {
+	if e == 1 {
+		return c
+	}
+	return adjusted{c, e}
+}
+
+type (
+	srgb  struct{}
+	lstar struct{}
+
+	adjusted struct {
+		c Curve
+		e float64
+	}
+)
+
+var (
+	// SRGB is the sRGB (IEC 61966-2-1) transfer curve.
+	SRGB Curve = srgb{}
+
+	// LStar is the inverse of CIE 1976 lightness, L*, so that
+	// equal steps of input look like equal steps of brightness.
+	LStar Curve = lstar{}
+)
+
+// Linear implements Curve.
+func (srgb) Linear(v uint8) float64 {
+	x := float64(v) / 255
+	if x <= 0.04045 {
+		return x / 12.92
+	}
+	return math.Pow((x+0.055)/1.055, 2.4)
+}
+
+func (srgb) String() string {
+	return "srgb"
+}
+
+// Linear implements Curve.
+func (lstar) Linear(v uint8) float64 {
+	l := 100 * float64(v) / 255
+	if l <= 8 {
+		return l * 27 / 24389
+	}
+	return math.Pow((l+16)/116, 3)
+}
+
+func (lstar) String() string {
+	return "lstar"
+}
+
+// Linear implements Curve.
+func (a adjusted) Linear(v uint8) float64 {
+	return math.Pow(a.c.Linear(v), a.e)
+}
+
+func (a adjusted) String() string {
+	return fmt.Sprint(a.c, " ^ ", a.e)
+}
+
+// LUT is a Curve given by a table, such as light meter readings of
+// the panels at each input level.
+type LUT struct {
+	Name   string
+	values [256]float64
+}
+
+// Linear implements Curve.
+func (t *LUT) Linear(v uint8) float64 {
+	return t.values[v]
+}
+
+func (t *LUT) String() string {
+	return t.Name
+}
+
+// ParseLUT reads 256 non-negative numbers, one per input level,
+// separated by white space.  Text from # to the end of a line is a
+// comment.  The values are divided by the largest, so the readings
+// may be in any unit.
+func ParseLUT(name string, r io.Reader) (*LUT, error) {
+	t := &LUT{Name: name}
+	n := 0
+	max := 0.0
+
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		text, _, _ := strings.Cut(scan.Text(), "#")
+		for _, field := range strings.Fields(text) {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+				return nil, fmt.Errorf("%s:%d: invalid value %q", name, line, field)
+			}
+			if n == len(t.values) {
+				return nil, fmt.Errorf("%s:%d: more than %d values", name, line, len(t.values))
+			}
+			t.values[n] = v
+			max = math.Max(max, v)
+			n++
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if n != len(t.values) {
+		return nil, fmt.Errorf("%s: %d values, need %d", name, n, len(t.values))
+	}
+	if max == 0 {
+		return nil, fmt.Errorf("%s: all values are zero", name)
+	}
+	for i := range t.values {
+		t.values[i] /= max
+	}
+	return t, nil
+}
+
+// LoadLUT reads a LUT from a file, see ParseLUT.
+func LoadLUT(name string) (*LUT, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLUT(name, f)
+}
+
+// ParseCurve selects a Curve by name: "srgb", "lstar", a gamma such
+// as "2.2", or otherwise the name of a LUT file.
+func ParseCurve(name string) (Curve, error) {
+	switch name {
+	case "srgb":
+		return SRGB, nil
+	case "lstar":
+		return LStar, nil
+	}
+	if g, err := strconv.ParseFloat(name, 64); err == nil {
+		if g <= 0 || math.IsInf(g, 0) || math.IsNaN(g) {
+			return nil, fmt.Errorf("invalid gamma %v", g)
+		}
+		return Gamma(g), nil
+	}
+	return LoadLUT(name)
+}
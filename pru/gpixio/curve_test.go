@@ -0,0 +1,123 @@
+package gpixio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCurves(t *testing.T) {
+	for _, test := range []struct {
+		curve Curve
+		v     uint8
+		want  float64
+	}{
+		{Gamma(2.2), 128, 0.2195},
+		{SRGB, 0, 0},
+		{SRGB, 10, 0.003035},
+		{SRGB, 128, 0.2159},
+		{SRGB, 255, 1},
+		{LStar, 0, 0},
+		{LStar, 10, 0.004337},
+		{LStar, 128, 0.1858},
+		{LStar, 255, 1},
+		{Adjust(Gamma(1), 2.2), 128, 0.2195},
+		{Adjust(SRGB, 2), 128, 0.2159 * 0.2159},
+		{Adjust(SRGB, 1), 128, 0.2159},
+	} {
+		if got := test.curve.Linear(test.v); math.Abs(got-test.want) > 1e-4 {
+			t.Errorf("%v(%d) = %f, want %f", test.curve, test.v, got, test.want)
+		}
+	}
+	// Adjustments are cached like any Curve.
+	if Adjust(SRGB, 1) != SRGB || Adjust(SRGB, 2) != Adjust(SRGB, 2) {
+		t.Error("adjusted curves are not comparable")
+	}
+}
+
+func TestParseLUT(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("# light meter, cd/m^2\n")
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&sb, "%d ", 2*i)
+		if i%16 == 15 {
+			sb.WriteString("\n")
+		}
+	}
+	lut, err := ParseLUT("meter", strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lut.Linear(255) != 1 || lut.Linear(0) != 0 || math.Abs(lut.Linear(51)-0.2) > 1e-9 {
+		t.Errorf("not normalized: %v %v %v", lut.Linear(0), lut.Linear(51), lut.Linear(255))
+	}
+
+	for _, bad := range []string{
+		"1 2 3",
+		strings.Repeat("1 ", 257),
+		strings.Repeat("0 ", 256),
+		strings.Repeat("1 ", 255) + "-1",
+		strings.Repeat("1 ", 255) + "x",
+		strings.Repeat("1 ", 255) + "NaN",
+	} {
+		if _, err := ParseLUT("bad", strings.NewReader(bad)); err == nil {
+			t.Errorf("%.20q...: no error", bad)
+		}
+	}
+}
+
+func TestParseCurve(t *testing.T) {
+	for name, want := range map[string]Curve{
+		"srgb":  SRGB,
+		"lstar": LStar,
+		"2.2":   Gamma(2.2),
+	} {
+		if got, err := ParseCurve(name); err != nil || got != want {
+			t.Errorf("%s: %v, %v", name, got, err)
+		}
+	}
+	for _, bad := range []string{"0", "-1", "NaN", "Inf", "/nonexistent"} {
+		if _, err := ParseCurve(bad); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+// countingCurve counts calls to Linear.
+type countingCurve struct {
+	calls *int
+}
+
+func (c countingCurve) Linear(v uint8) float64 {
+	*c.calls++
+	return float64(v) / 255
+}
+
+func TestCurveCache(t *testing.T) {
+	var calls int
+	curve := countingCurve{&calls}
+
+	b := NewBuffer()
+	var fb FrameBank
+
+	expect := func(want int) {
+		t.Helper()
+		b.Copy1(curve, &fb)
+		if calls != want {
+			t.Fatalf("%d calls, want %d", calls, want)
+		}
+	}
+
+	expect(2 * 256)
+	expect(2 * 256)
+	if err := b.SetDepth(7); err != nil {
+		t.Fatal(err)
+	}
+	expect(4 * 256)
+
+	// Another Curve rebuilds, returning to this one rebuilds
+	// again.
+	b.Copy1(SRGB, &fb)
+	expect(6 * 256)
+}
@@ -0,0 +1,68 @@
+package gpixio
+
+import (
+	"image"
+)
+
+// Decode reverses the encoding of fb for the DefaultLayout on the
+// Octoscroller.  See Buffer.Decode.
+func Decode(fb *FrameBank) *image.RGBA {
+	return NewBuffer().Decode(fb)
+}
+
+// Decode counts the frames in which each LED of fb is lit, returning
+// the image as it appears on the panels of this Buffer.  Since the
+// PRU displays every frame for the same time, each channel is the
+// duty cycle scaled to 0-255, e.g., a 6-bit value d decodes as d<<2.
+func (b *Buffer) Decode(fb *FrameBank) *image.RGBA {
+	img := image.NewRGBA(b.Bounds())
+	b.DecodeTo(img, fb)
+	return img
+}
+
+// DecodeTo is Decode into img, which must have the bounds of this
+// Buffer, so that an image may be reused for every bank.
+func (b *Buffer) DecodeTo(img *image.RGBA, fb *FrameBank) {
+	l := &b.layout
+	clocks := l.Clocks()
+	frames := l.FramesPerBank()
+	dps := fb.pixels()
+
+	// Pixels on no output are black.
+	for i := range img.Pix {
+		img.Pix[i] = 0
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+
+	for rowSel := 0; rowSel < l.Scan; rowSel++ {
+		for x := 0; x < clocks; x++ {
+			var counts [2 * maxOutputs][3]int
+
+			for f := 0; f < frames; f++ {
+				dp := &dps[(f*l.Scan+rowSel)*clocks+x]
+				words := [4]uint32{dp.Gpio0, dp.Gpio1, dp.Gpio2, dp.Gpio3}
+
+				for bank, cbs := range &b.pins.colors {
+					if words[bank] == 0 {
+						continue
+					}
+					for _, cb := range cbs {
+						if cb.pos >= 2*l.Outputs || words[bank]&(1<<cb.bit) == 0 {
+							continue
+						}
+						counts[cb.pos][cb.channel]++
+					}
+				}
+			}
+
+			for pos := 0; pos < 2*l.Outputs; pos++ {
+				o := l.pixelOffset(img.Stride, rowSel, x, pos)
+				for channel, n := range counts[pos] {
+					img.Pix[o+channel] = uint8(min(n*256/frames, 255))
+				}
+			}
+		}
+	}
+}
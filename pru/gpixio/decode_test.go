@@ -0,0 +1,257 @@
+package gpixio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// sixBit is the value a channel decodes to after a linear Copy0.
+func sixBit(v uint8) uint8 {
+	return degammaSix(1)[v] << 2
+}
+
+func checkDecoded(t *testing.T, src, dec *image.RGBA) {
+	t.Helper()
+	for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+		for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+			s := src.RGBAAt(x, y)
+			d := dec.RGBAAt(x, y)
+			want := color.RGBA{sixBit(s.R), sixBit(s.G), sixBit(s.B), 255}
+			if d != want {
+				t.Fatalf("pixel (%d, %d): decoded %v, want %v", x, y, d, want)
+			}
+		}
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	buf := NewBuffer()
+	rand.New(rand.NewSource(1)).Read(buf.Pix)
+
+	var fb FrameBank
+	buf.Copy0(Gamma(1), &fb)
+
+	checkDecoded(t, buf.RGBA, Decode(&fb))
+}
+
+func TestDecodeDepth(t *testing.T) {
+	buf := NewBuffer()
+	rand.New(rand.NewSource(1)).Read(buf.Pix)
+
+	for depth := MinDepth; depth <= MaxDepth; depth++ {
+		if err := buf.SetDepth(depth); err != nil {
+			t.Fatal(err)
+		}
+		deg := degamma(Gamma(1), 1, depth)
+
+		var fb FrameBank
+		buf.Copy1(Gamma(1), &fb)
+		dec := Decode(&fb)
+
+		for i, v := range buf.Pix {
+			if i%4 == 3 {
+				continue
+			}
+			if want := uint8(deg[v] << (8 - depth)); dec.Pix[i] != want {
+				t.Fatalf("depth %d: offset %d decoded %d, want %d", depth, i, dec.Pix[i], want)
+			}
+		}
+	}
+}
+
+func TestDecodeEachOutput(t *testing.T) {
+	l := DefaultLayout
+	colors := []color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+		{R: 100, G: 150, B: 200, A: 255},
+	}
+
+	for output := 0; output < l.Outputs; output++ {
+		for half := 0; half < 2; half++ {
+			t.Run(fmt.Sprintf("J%d_%d", output+1, half+1), func(t *testing.T) {
+				buf := NewBuffer()
+
+				// The region of the image driven by
+				// this output and half of its panel.
+				x0 := (output / l.Stack) * l.Clocks()
+				y0 := (output%l.Stack)*l.PanelHeight + half*l.Scan
+				region := image.Rect(x0, y0, x0+l.Clocks(), y0+l.Scan)
+
+				c := colors[(2*output+half)%len(colors)]
+				draw.Draw(buf.RGBA, region, image.NewUniform(c), image.Point{}, draw.Src)
+
+				var fb FrameBank
+				buf.Copy0(Gamma(1), &fb)
+				dec := Decode(&fb)
+
+				checkDecoded(t, buf.RGBA, dec)
+
+				if got := dec.RGBAAt(x0, y0); got != (color.RGBA{sixBit(c.R), sixBit(c.G), sixBit(c.B), 255}) {
+					t.Errorf("region origin decoded %v", got)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeChainedLayout(t *testing.T) {
+	buf, err := NewBufferLayout(Layout{
+		PanelWidth:  64,
+		PanelHeight: 32,
+		Scan:        16,
+		Chain:       2,
+		Outputs:     3,
+		Stack:       2,
+	}, Octoscroller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := buf.Rect.Dx(), buf.Rect.Dy(); w != 256 || h != 64 {
+		t.Fatalf("buffer size %dx%d", w, h)
+	}
+	rand.New(rand.NewSource(2)).Read(buf.Pix)
+
+	// The third output occupies only the upper half of the
+	// second column; the lower half is not displayed.
+	draw.Draw(buf.RGBA, image.Rect(128, 32, 256, 64), image.Black, image.Point{}, draw.Src)
+
+	var fb FrameBank
+	buf.Copy0(Gamma(1), &fb)
+
+	checkDecoded(t, buf.RGBA, buf.Decode(&fb))
+}
+
+func TestDecodePartialCycle(t *testing.T) {
+	// Three chained panels leave 85 frames per bank: one 64-frame
+	// cycle, then 21 blank frames.
+	l := DefaultLayout
+	l.Chain = 3
+	if n := l.FramesPerBank(); n != 85 {
+		t.Fatalf("%d frames per bank", n)
+	}
+
+	for name, copy := range map[string]func(*Buffer, *FrameBank){
+		"Copy0": func(b *Buffer, fb *FrameBank) { b.Copy0(Gamma(1), fb) },
+		"Copy1": func(b *Buffer, fb *FrameBank) { b.Copy1(Gamma(1), fb) },
+	} {
+		buf, err := NewBufferLayout(l, Octoscroller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rand.New(rand.NewSource(3)).Read(buf.Pix)
+
+		fb := new(FrameBank)
+		dps := fb.pixels()
+		for i := range dps {
+			dps[i] = DoublePixel{^uint32(0), ^uint32(0), ^uint32(0), ^uint32(0)}
+		}
+		copy(buf, fb)
+
+		for i, dp := range dps[64*l.FrameSize() : 85*l.FrameSize()] {
+			if dp != (DoublePixel{}) {
+				t.Fatalf("%s: blank frame %d is lit", name, 64+i/l.FrameSize())
+			}
+		}
+
+		// Every value is lit for its share of the one cycle.
+		dec := buf.Decode(fb)
+		for i, v := range buf.Pix {
+			if i%4 == 3 {
+				continue
+			}
+			if want := uint8(int(degammaSix(1)[v]) * 256 / 85); dec.Pix[i] != want {
+				t.Fatalf("%s: offset %d decoded %d, want %d", name, i, dec.Pix[i], want)
+			}
+		}
+	}
+}
+
+func TestDecodeScan32(t *testing.T) {
+	// Three chained 64x64 1/32 scan panels leave 42 frames per
+	// bank: one 32-frame cycle at depth 5, then 10 blank frames.
+	l := Layout{
+		PanelWidth:  64,
+		PanelHeight: 64,
+		Scan:        32,
+		Chain:       3,
+		Outputs:     8,
+		Stack:       4,
+	}
+	if n := l.FramesPerBank(); n != 42 {
+		t.Fatalf("%d frames per bank", n)
+	}
+
+	// The Octoscroller wires four row-select lines; a cape
+	// wiring the fifth, here to gpio0_20, addresses 1/32 scan.
+	if _, err := NewBufferLayout(l, Octoscroller); err == nil {
+		t.Fatal("the Octoscroller addressed 1/32 scan")
+	}
+	cf, err := OpenFile("", OctoscrollerCape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	cape, err := ParseCape(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cape.Controls.Sel4 = CapePin{Pin: "P9-41", Type: "gpio"}
+	pf, err := OpenFile("", BBBPins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	pins, err := ParsePins(pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinout, err := NewPinout(cape, pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := NewBufferLayout(l, pinout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Depth() != 5 {
+		t.Fatalf("depth %d", buf.Depth())
+	}
+	if err := buf.SetDepth(6); err == nil {
+		t.Fatal("a 64-frame cycle fit in 42 frames")
+	}
+	rand.New(rand.NewSource(4)).Read(buf.Pix)
+
+	var fb0, fb1 FrameBank
+	buf.Copy0(Gamma(1), &fb0)
+	buf.Copy1(Gamma(1), &fb1)
+	if fb0 != fb1 {
+		t.Fatal("Copy0 and Copy1 differ")
+	}
+
+	// The fifth line selects the lower 16 row addresses.
+	dps := fb0.pixels()
+	for rowSel := 0; rowSel < l.Scan; rowSel++ {
+		addr := (rowSel + l.Scan - 1) % l.Scan
+		if got := dps[rowSel*l.Clocks()].Gpio0 >> 20 & 1; got != uint32(addr>>4) {
+			t.Fatalf("row %d: sel4 is %d", rowSel, got)
+		}
+	}
+
+	deg := degamma(Gamma(1), 1, 5)
+	dec := buf.Decode(&fb0)
+	for i, v := range buf.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		if want := uint8(int(deg[v]) * 256 / 42); dec.Pix[i] != want {
+			t.Fatalf("offset %d decoded %d, want %d", i, dec.Pix[i], want)
+		}
+	}
+}
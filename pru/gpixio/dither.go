@@ -0,0 +1,153 @@
+package gpixio
+
+import (
+	"math"
+)
+
+// Dither selects how the encoder rounds each channel to the PWM
+// depth.  Without dithering, the fraction below one PWM step is
+// discarded.  With dithering, it decides how often the channel
+// rounds up, in time, in space, or both, so that the panels show
+// the fraction on average.
+type Dither int
+
+const (
+	// DitherTemporal varies the rounding across the repeated PWM
+	// cycles of a bank and across successive banks, four phases
+	// in all.
+	DitherTemporal Dither = 1 << iota
+
+	// DitherSpatial varies the rounding in a 4x4 ordered (Bayer)
+	// pattern across the image.
+	DitherSpatial
+
+	DitherNone Dither = 0
+)
+
+const (
+	temporalPhases = 4
+	spatialCells   = 16
+)
+
+// bayer4 is the 4x4 ordered dither matrix, in row-major order.
+var bayer4 = [spatialCells]int{
+	0, 8, 2, 10,
+	12, 4, 14, 6,
+	3, 11, 1, 9,
+	15, 7, 13, 5,
+}
+
+// SetDither selects the dithering mode.  This must not be called
+// concurrently with encoding.
+func (b *Buffer) SetDither(d Dither) {
+	b.dither = d
+}
+
+// Dither returns the dithering mode.
+func (b *Buffer) Dither() Dither {
+	return b.dither
+}
+
+// scaleSteps is the resolution of the brightness encoded.  Rounding
+// the limiter's brightness to it keeps the selection, and so the
+// tracked contents of the banks, the same once the limiter settles.
+const scaleSteps = 256
+
+// selection is what the quantization tables are built from.
+type selection struct {
+	curve  Curve
+	depth  int
+	scale  float64
+	dither Dither
+}
+
+// prepare readies the quantization tables for one encoding and
+// returns the number of PWM cycles to encode.  The rest of the bank
+// repeats those cycles.  The tables are only rebuilt when the
+// selection changes.
+func (b *Buffer) prepare(c Curve) int {
+	scale := math.Round(b.scale*scaleSteps) / scaleSteps
+	if s := (selection{c, b.depth, scale, b.dither}); s != b.selected {
+		b.selected = s
+		b.build(c)
+	}
+
+	if b.dither&DitherTemporal == 0 {
+		return 1
+	}
+	cycles := b.layout.cycleFrames(b.depth) >> b.depth
+	if cycles > temporalPhases {
+		cycles = temporalPhases
+	}
+	return cycles
+}
+
+// build fills the linear and quantization tables for curve c, at the
+// selected brightness.
+func (b *Buffer) build(c Curve) {
+	for i := range b.linear {
+		b.linear[i] = c.Linear(uint8(i))
+	}
+
+	if b.dither == DitherNone {
+		b.tables[0] = degamma(c, b.selected.scale, b.depth)
+		b.thresholds[0] = 0
+		return
+	}
+
+	phases, cells := 1, 1
+	if b.dither&DitherTemporal != 0 {
+		phases = temporalPhases
+	}
+	if b.dither&DitherSpatial != 0 {
+		cells = spatialCells
+	}
+	levels := float64(phases * cells)
+	top := float64(int(1)<<b.depth - 1)
+
+	for phase := 0; phase < phases; phase++ {
+		for cell := 0; cell < cells; cell++ {
+			rank := phase
+			if cells > 1 {
+				rank = bayer4[cell]*phases + phase
+			}
+			threshold := (float64(rank) + 0.5) / levels
+			b.thresholds[phase*spatialCells+cell] = uint16(threshold * (1 << levelBits))
+
+			t := &b.tables[phase*spatialCells+cell]
+			for i := range t {
+				t[i] = uint16(math.Min(top, math.Floor(b.selected.scale*b.linear[i]*top+threshold)))
+			}
+		}
+	}
+}
+
+// table returns the quantization table for PWM cycle c of a pixel
+// in the given cell, (y%4)*4 + x%4, of the dither pattern.
+func (b *Buffer) table(c, cell int) *[256]uint16 {
+	return &b.tables[b.ditherIndex(c, cell)]
+}
+
+// level quantizes the calibrated level at offset o of the image,
+// for PWM cycle c of a pixel in the given cell.
+func (b *Buffer) level(o, c, cell int) uint16 {
+	v := (uint32(b.levels[o]) + uint32(b.thresholds[b.ditherIndex(c, cell)])) >> levelBits
+	if top := uint32(1)<<b.depth - 1; v > top {
+		return uint16(top)
+	}
+	return uint16(v)
+}
+
+func (b *Buffer) ditherIndex(c, cell int) int {
+	i := 0
+	if b.dither&DitherTemporal != 0 {
+		// Successive banks continue the sequence of phases
+		// when the bank holds fewer than four cycles.
+		cycles := b.layout.cycleFrames(b.depth) >> b.depth
+		i = (int(b.encodes)*cycles + c) % temporalPhases * spatialCells
+	}
+	if b.dither&DitherSpatial != 0 {
+		i += cell
+	}
+	return i
+}
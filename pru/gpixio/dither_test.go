@@ -0,0 +1,108 @@
+package gpixio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDitherCopyEquivalence(t *testing.T) {
+	for _, d := range []Dither{DitherTemporal, DitherSpatial, DitherTemporal | DitherSpatial} {
+		for depth := MinDepth; depth <= MaxDepth; depth++ {
+			t.Run(fmt.Sprintf("dither%d_depth%d", d, depth), func(t *testing.T) {
+				b0 := NewBuffer()
+				b1 := NewBuffer()
+				for _, b := range []*Buffer{b0, b1} {
+					rand.New(rand.NewSource(3)).Read(b.Pix)
+					b.SetDither(d)
+					if err := b.SetDepth(depth); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				var fb0, fb1 FrameBank
+				b0.Copy0(Gamma(2.2), &fb0)
+				b1.Copy1(Gamma(2.2), &fb1)
+				if fb0 != fb1 {
+					t.Fatal("Copy0 and Copy1 differ")
+				}
+			})
+		}
+	}
+}
+
+// meanError returns the largest difference, over a few dark and
+// mid-range gray levels, between the mean decoded value of a uniform image and its
+// linear brightness, after encoding it the given number of times.
+func meanError(t *testing.T, d Dither, depth, encodes int) float64 {
+	t.Helper()
+	b := NewBuffer()
+	b.SetDither(d)
+	if err := b.SetDepth(depth); err != nil {
+		t.Fatal(err)
+	}
+	top := float64(int(1)<<depth-1) / float64(int(1)<<depth)
+
+	worst := 0.0
+	for _, v := range []int{1, 3, 50, 129, 254} {
+		draw.Draw(b.RGBA, b.Bounds(), image.NewUniform(color.Gray{uint8(v)}), image.Point{}, draw.Src)
+
+		sum := 0.0
+		for e := 0; e < encodes; e++ {
+			var fb FrameBank
+			b.Copy1(Gamma(1), &fb)
+			// Only the first 4x4 block, which covers
+			// the spatial pattern.
+			dec := b.Decode(&fb)
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 4; x++ {
+					sum += float64(dec.RGBAAt(x, y).G)
+				}
+			}
+		}
+		mean := sum / float64(16*encodes)
+		want := 256 * top * float64(v) / 255
+		worst = math.Max(worst, math.Abs(mean-want))
+	}
+	return worst
+}
+
+func TestDitherPrecision(t *testing.T) {
+	for _, test := range []struct {
+		dither  Dither
+		depth   int
+		encodes int
+		max     float64
+	}{
+		// One 6-bit step is 4 decoded units.
+		{DitherNone, 6, 1, 4},
+		// Four phases within one bank.
+		{DitherTemporal, 6, 1, 1},
+		// Four phases across four banks.
+		{DitherTemporal, 8, 4, 0.25},
+		{DitherSpatial, 6, 1, 0.25},
+		{DitherTemporal | DitherSpatial, 6, 1, 1.0 / 16},
+	} {
+		if got := meanError(t, test.dither, test.depth, test.encodes); got > test.max {
+			t.Errorf("dither %d depth %d: error %.3f > %.3f", test.dither, test.depth, got, test.max)
+		}
+	}
+}
+
+func TestDitherBlack(t *testing.T) {
+	b := NewBuffer()
+	b.SetDither(DitherTemporal | DitherSpatial)
+
+	var fb FrameBank
+	b.Copy1(Gamma(2.2), &fb)
+
+	for _, v := range b.Decode(&fb).Pix {
+		if v != 0 && v != 255 {
+			t.Fatal("black is not black")
+		}
+	}
+}
@@ -28,8 +28,19 @@
 #define WORDSZ sizeof(uint32_t)
 
 #define FRAMEBUF_GPIOS 4
+
+// These must match the gpixio.Layout: Scan and Clocks().  Build
+// with, e.g., make FRAMEBUF_SCANS=32 FRAMEBUF_WIDTH=192 for three
+// chained 64x64 1/32 scan panels.  ledctrl checks them at startup.
+#ifndef FRAMEBUF_SCANS
 #define FRAMEBUF_SCANS 16
+#endif
+#ifndef FRAMEBUF_WIDTH
 #define FRAMEBUF_WIDTH 64
+#endif
+
+// STATIC_ASSERT fails to compile unless cond holds.
+#define STATIC_ASSERT(cond, name) typedef char static_assert_##name[(cond) ? 1 : -1]
 
 // 16B
 #define FRAMEBUF_PIXEL_SIZE (FRAMEBUF_GPIOS * WORDSZ)
@@ -41,13 +52,16 @@
 #define FRAMEBUF_FRAME_SIZE (FRAMEBUF_SCANS * FRAMEBUF_SCAN_SIZE)
 
 // 4KB local
-#define FRAMEBUF_PART_SIZE (1U << 12)
+#define FRAMEBUF_LOCAL_SIZE (1U << 12)
 
-// 4 parts per frame
-#define FRAMEBUF_PARTS_PER_FRAME (FRAMEBUF_FRAME_SIZE / FRAMEBUF_PART_SIZE)
+// 4 scans per part, as many whole scans as fit locally
+#define FRAMEBUF_SCANS_PER_PART (FRAMEBUF_LOCAL_SIZE / FRAMEBUF_SCAN_SIZE)
 
-// 4 scans per part
-#define FRAMEBUF_SCANS_PER_PART (FRAMEBUF_SCANS / FRAMEBUF_PARTS_PER_FRAME)
+// 4KB per part
+#define FRAMEBUF_PART_SIZE (FRAMEBUF_SCANS_PER_PART * FRAMEBUF_SCAN_SIZE)
+
+// 4 parts per frame
+#define FRAMEBUF_PARTS_PER_FRAME (FRAMEBUF_SCANS / FRAMEBUF_SCANS_PER_PART)
 
 // carveout 8MB
 #define FRAMEBUF_TOTAL_SIZE (1U << 23)
@@ -58,6 +72,10 @@
 // 256 frames per bank
 #define FRAMEBUF_FRAMES_PER_BANK (FRAMEBUF_BANK_SIZE / FRAMEBUF_FRAME_SIZE)
 
+// A scan must fit locally, and the parts must divide a frame evenly.
+STATIC_ASSERT(FRAMEBUF_SCANS_PER_PART >= 1, scan_fits_locally);
+STATIC_ASSERT(FRAMEBUF_SCANS % FRAMEBUF_SCANS_PER_PART == 0, parts_divide_scans);
+
 typedef struct control control_t;
 
 struct control {
@@ -68,6 +86,10 @@ struct control {
 
   volatile uint32_t ready_bank;
   volatile uint32_t start_bank;
+
+  // The geometry built in, FRAMEBUF_SCANS and FRAMEBUF_WIDTH.
+  volatile uint32_t framebuf_scans;
+  volatile uint32_t framebuf_width;
 };
 
 // Using fpp/capes/bbb/panels/Octoscroller.json as a reference.
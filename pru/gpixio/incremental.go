@@ -0,0 +1,133 @@
+package gpixio
+
+import (
+	"bytes"
+)
+
+// maxTracked is the number of FrameBanks whose contents are
+// remembered, two for the double-buffered Frameset.
+const maxTracked = 2
+
+// encoding is everything besides the image that determines the
+// contents of an encoded bank.
+type encoding struct {
+	selection
+	profile *Profile
+
+	// phase is the temporal dither phase of the first cycle.
+	phase int
+}
+
+// bankState remembers what a FrameBank holds, so that encoding into
+// it again need only rewrite the scan rows whose input changed.
+// Tracking is per bank, because with two banks in turn, the bank
+// being filled holds the image from two encodings ago.
+type bankState struct {
+	key   encoding
+	valid bool
+
+	// pix is the image the bank was encoded from, and changed
+	// whether this encoding's differs.
+	pix     []byte
+	changed bool
+
+	// dirty marks the scan rows to rewrite in this encoding.
+	dirty []bool
+
+	// lit counts the lit time slices of each output by scan
+	// row, for the power estimate.
+	lit [][maxOutputs]int
+}
+
+// Invalidate forgets the contents of every FrameBank, so that the
+// next encoding into each rewrites all of it.  Call this if banks
+// are written other than by Copy0 and Copy1.
+func (b *Buffer) Invalidate() {
+	b.banks = nil
+}
+
+// track compares the image with the one last encoded into fb,
+// marking the scan rows that need rewriting, and records the image.
+func (b *Buffer) track(fb *FrameBank) *bankState {
+	l := &b.layout
+
+	key := encoding{
+		selection: b.selected,
+		profile:   b.profile,
+	}
+	if b.dither&DitherTemporal != 0 {
+		key.phase = int(b.encodes) * (l.cycleFrames(b.depth) >> b.depth) % temporalPhases
+	}
+
+	st := b.banks[fb]
+	if st == nil {
+		if len(b.banks) >= maxTracked {
+			b.banks = nil
+		}
+		if b.banks == nil {
+			b.banks = map[*FrameBank]*bankState{}
+		}
+		st = &bankState{
+			pix:   make([]byte, len(b.Pix)),
+			dirty: make([]bool, l.Scan),
+			lit:   make([][maxOutputs]int, l.Scan),
+		}
+		b.banks[fb] = st
+	}
+
+	valid := st.valid && st.key == key
+	st.changed = !st.valid
+	for rowSel := range st.dirty {
+		same := st.valid && b.sameRows(st.pix, rowSel)
+		st.changed = st.changed || !same
+		st.dirty[rowSel] = !valid || !same
+	}
+	st.key = key
+	st.valid = true
+	copy(st.pix, b.Pix)
+	return st
+}
+
+// sameRows tests whether the image rows of every position at scan
+// row rowSel are the same in pix as in the Buffer.
+func (b *Buffer) sameRows(pix []byte, rowSel int) bool {
+	l := &b.layout
+	n := 4 * l.Clocks()
+	for pos := 0; pos < 2*l.Outputs; pos++ {
+		o := l.pixelOffset(b.Stride, rowSel, 0, pos)
+		if !bytes.Equal(pix[o:o+n], b.Pix[o:o+n]) {
+			return false
+		}
+	}
+	return true
+}
+
+// repeat copies the first PWM cycles, of the given number of frames,
+// through the used frames of the bank for the dirty scan rows, and
+// blanks those rows in the frames after them.
+func (st *bankState) repeat(l *Layout, dps []DoublePixel, frames, used int) {
+	all := true
+	for _, d := range st.dirty {
+		all = all && d
+	}
+	if all {
+		l.repeatCycle(dps, frames, used)
+		return
+	}
+
+	clocks := l.Clocks()
+	for f := frames; f < l.FramesPerBank(); f++ {
+		for rowSel, d := range st.dirty {
+			if !d {
+				continue
+			}
+			dst := (f*l.Scan + rowSel) * clocks
+			if f >= used {
+				clear(dps[dst : dst+clocks])
+				continue
+			}
+			src := (f%frames*l.Scan + rowSel) * clocks
+			copy(dps[dst:dst+clocks], dps[src:src+clocks])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package gpixio
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// TestIncrementalMatchesFull encodes a changing image into two banks
+// in turn, as control does, and compares each with a full encoding.
+func TestIncrementalMatchesFull(t *testing.T) {
+	warm := &Profile{Outputs: map[string]Calibration{
+		"J3": {Matrix: Identity.Matrix, Gain: [3]float64{1, 0.9, 0.7}, Curve: [3]float64{1.1, 1, 1}},
+	}}
+	for _, test := range []struct {
+		name    string
+		dither  Dither
+		depth   int
+		profile *Profile
+	}{
+		{"plain", DitherNone, MinDepth, nil},
+		{"temporal6", DitherTemporal, 6, nil},
+		{"temporal8", DitherTemporal | DitherSpatial, 8, nil},
+		{"calibrated", DitherTemporal, 7, warm},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(5))
+			inc := NewBuffer()
+			full := NewBuffer()
+			for _, b := range []*Buffer{inc, full} {
+				b.SetDither(test.dither)
+				if err := b.SetDepth(test.depth); err != nil {
+					t.Fatal(err)
+				}
+				if err := b.SetProfile(test.profile); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rnd.Read(inc.Pix)
+
+			var banks [2]FrameBank
+			for i := 0; i < 6; i++ {
+				// Change a few pixels of one row.
+				y := rnd.Intn(inc.Rect.Dy())
+				x := rnd.Intn(inc.Rect.Dx() - 8)
+				draw.Draw(inc.RGBA, image.Rect(x, y, x+8, y+1), image.NewUniform(color.RGBA{uint8(i), 200, 100, 255}), image.Point{}, draw.Src)
+
+				fb := &banks[i%2]
+				if i%2 == 0 {
+					inc.Copy0(SRGB, fb)
+				} else {
+					inc.Copy1(SRGB, fb)
+				}
+
+				// The full encoding starts from scratch
+				// at the same point in the dither sequence.
+				copy(full.Pix, inc.Pix)
+				full.encodes = inc.encodes - 1
+				full.Invalidate()
+				var want FrameBank
+				full.Copy1(SRGB, &want)
+
+				if *fb != want {
+					t.Fatalf("encoding %d differs", i)
+				}
+				if inc.Power().Total != full.Power().Total {
+					t.Fatalf("encoding %d: power %v, want %v", i, inc.Power(), full.Power())
+				}
+			}
+		})
+	}
+}
+
+func TestIncrementalDirtyRows(t *testing.T) {
+	b := NewBuffer()
+	rand.New(rand.NewSource(6)).Read(b.Pix)
+
+	var fb FrameBank
+	dirty := func() (n int) {
+		b.Copy1(SRGB, &fb)
+		for _, d := range b.banks[&fb].dirty {
+			if d {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := dirty(); n != b.layout.Scan {
+		t.Errorf("first encoding: %d dirty rows", n)
+	}
+	if n := dirty(); n != 0 {
+		t.Errorf("unchanged: %d dirty rows", n)
+	}
+
+	// One character of text touches a few rows.
+	draw.Draw(b.RGBA, image.Rect(10, 40, 16, 48), image.White, image.Point{}, draw.Src)
+	if n := dirty(); n != 8 {
+		t.Errorf("6x8 change: %d dirty rows", n)
+	}
+
+	if err := b.SetDepth(7); err != nil {
+		t.Fatal(err)
+	}
+	if n := dirty(); n != b.layout.Scan {
+		t.Errorf("new depth: %d dirty rows", n)
+	}
+
+	b.Invalidate()
+	if n := dirty(); n != b.layout.Scan {
+		t.Errorf("invalidated: %d dirty rows", n)
+	}
+}
+
+// BenchmarkCopy1Incremental encodes an image with one changed
+// character per frame into two banks in turn.
+func BenchmarkCopy1Incremental(b *testing.B) {
+	buf := NewBuffer()
+	rand.New(rand.NewSource(7)).Read(buf.Pix)
+
+	var banks [2]FrameBank
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x := i % 20 * 6
+		draw.Draw(buf.RGBA, image.Rect(x, 40, x+6, 48), image.NewUniform(color.Gray{uint8(i)}), image.Point{}, draw.Src)
+		buf.Copy1(Gamma(2.2), &banks[i%2])
+	}
+}
+
+func TestIncrementalPowerLimit(t *testing.T) {
+	b := NewBuffer()
+	rand.New(rand.NewSource(8)).Read(b.Pix)
+	if err := b.SetPowerLimit(PowerLimit{AmpsPerLED: 0.01, Amps: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the limiter settles on an unchanged image, encoding
+	// into either bank rewrites nothing.
+	var banks [2]FrameBank
+	dirty := func(i int) (n int) {
+		b.Copy1(SRGB, &banks[i%2])
+		for _, d := range b.banks[&banks[i%2]].dirty {
+			if d {
+				n++
+			}
+		}
+		return n
+	}
+	for i := 0; i < 100; i++ {
+		dirty(i)
+	}
+	p := b.Power()
+	if p.Scale == 1 || p.Total > 5 {
+		t.Fatalf("limiter inactive: %+v", p)
+	}
+	for i := 0; i < 4; i++ {
+		if n := dirty(i); n != 0 {
+			t.Errorf("settled bank %d: %d dirty rows", i, n)
+		}
+	}
+	if q := b.Power(); q.Scale != p.Scale || q.Total > 5 {
+		t.Errorf("settled at %+v, then %+v", p, q)
+	}
+	if banks[0] != banks[1] {
+		t.Error("settled banks differ")
+	}
+}
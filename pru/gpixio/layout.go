@@ -0,0 +1,172 @@
+package gpixio
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Layout describes the HUB75 panels attached to the cape, how they
+// are chained on each output, and where each output appears in the
+// Buffer.
+type Layout struct {
+	// PanelWidth and PanelHeight are the size of one panel in pixels.
+	PanelWidth  int
+	PanelHeight int
+
+	// Scan is the number of row addresses, e.g., 16 for a 1/16
+	// scan panel.  Each address lights one row in the upper half
+	// of the panel (r1, g1, b1) and one in the lower half (r2,
+	// g2, b2), so PanelHeight is twice Scan.
+	Scan int
+
+	// Chain is the number of panels daisy-chained on each
+	// output.  Chained panels extend to the right in the Buffer,
+	// the first pixel clocked out being the leftmost.
+	Chain int
+
+	// Outputs is the number of cape outputs in use, starting at J1.
+	Outputs int
+
+	// Stack is the number of outputs placed top-to-bottom in the
+	// Buffer before starting the next column.
+	Stack int
+}
+
+// DefaultLayout is the original Nerve wall: eight outputs, each
+// driving one 64x32 1/16-scan panel, in two columns of four.
+var DefaultLayout = Layout{
+	PanelWidth:  64,
+	PanelHeight: 32,
+	Scan:        16,
+	Chain:       1,
+	Outputs:     8,
+	Stack:       4,
+}
+
+const (
+	// maxOutputs is the number of HUB75 connectors on the cape.
+	maxOutputs = 8
+
+	// maxScan is limited by the five row-select lines, sel0-sel4,
+	// of an FPP cape.  Most capes wire only four.
+	maxScan = 32
+
+	// runLength is the number of pixels the encoder handles at once.
+	runLength = 16
+
+	// localClocks is the width of the widest row the PRU firmware
+	// holds in its 4KB local buffer, which it fills with whole
+	// rows, the same number each time.
+	localClocks = 256
+
+	// slices is the number of time slices encoded together, one
+	// per bit of a uint64 pattern, which is also the length of a
+	// PWM cycle at the minimum depth.
+	slices = 64
+
+	// bankPixels is the size of a FrameBank in DoublePixels, fixed
+	// by the PRU carveout regardless of the Layout.
+	bankPixels = len(FrameBank{}) * len(Frame{}) * len(DoubleRow{})
+)
+
+// Validate returns an error if the encoder or the PRU firmware cannot
+// drive this Layout.
+func (l Layout) Validate() error {
+	switch {
+	case l.PanelWidth <= 0 || l.PanelHeight <= 0:
+		return fmt.Errorf("invalid panel size: %dx%d", l.PanelWidth, l.PanelHeight)
+	case l.Scan <= 0 || l.Scan > maxScan:
+		return fmt.Errorf("unsupported scan: 1/%d", l.Scan)
+	case l.PanelHeight != 2*l.Scan:
+		return fmt.Errorf("panel height %d is not twice the scan %d", l.PanelHeight, l.Scan)
+	case l.Chain <= 0:
+		return fmt.Errorf("invalid chain length: %d", l.Chain)
+	case l.Outputs <= 0 || l.Outputs > maxOutputs:
+		return fmt.Errorf("invalid outputs: %d", l.Outputs)
+	case l.Stack <= 0:
+		return fmt.Errorf("invalid stack: %d", l.Stack)
+	case l.Clocks()%runLength != 0:
+		return fmt.Errorf("chain width %d is not a multiple of %d", l.Clocks(), runLength)
+	case l.Clocks() > localClocks || l.Scan%(localClocks/l.Clocks()) != 0:
+		return fmt.Errorf("PRU firmware cannot transfer %d rows of %d pixels in equal 4KB parts", l.Scan, l.Clocks())
+	case l.FramesPerBank() < 1<<MinDepth:
+		return fmt.Errorf("%d frames per bank, need at least %d", l.FramesPerBank(), 1<<MinDepth)
+	}
+	return nil
+}
+
+// Width is the width of the Buffer in pixels.
+func (l Layout) Width() int {
+	return l.columns() * l.Clocks()
+}
+
+// Height is the height of the Buffer in pixels.
+func (l Layout) Height() int {
+	if l.Outputs < l.Stack {
+		return l.Outputs * l.PanelHeight
+	}
+	return l.Stack * l.PanelHeight
+}
+
+// Clocks is the number of pixels clocked into each output per row
+// address, i.e., the width of one DoubleRow.
+func (l Layout) Clocks() int {
+	return l.PanelWidth * l.Chain
+}
+
+// FrameSize is the number of DoublePixels in one frame.  The PRU
+// firmware's FRAMEBUF_SCANS and FRAMEBUF_WIDTH must agree with Scan
+// and Clocks().
+func (l Layout) FrameSize() int {
+	return l.Scan * l.Clocks()
+}
+
+// FramesPerBank is the number of whole frames that fit in a FrameBank.
+func (l Layout) FramesPerBank() int {
+	return bankPixels / l.FrameSize()
+}
+
+// cycleFrames is the number of frames of a bank filled with whole
+// PWM cycles of the given depth.  When FramesPerBank is not a
+// multiple of the cycle, e.g., 85 frames for three chained 64x32
+// panels, the remaining frames are left blank: a partial cycle would
+// light low values for more than their share of the bank.
+func (l Layout) cycleFrames(depth int) int {
+	return l.FramesPerBank() &^ (1<<depth - 1)
+}
+
+func (l Layout) columns() int {
+	return (l.Outputs + l.Stack - 1) / l.Stack
+}
+
+// pixelOffset returns the offset in an RGBA image with the given
+// stride of the pixel clocked at position x of row address rowSel
+// on position pos (i.e., J1_1 through J8_2).
+func (l Layout) pixelOffset(stride, rowSel, x, pos int) int {
+	output := pos / 2
+	half := pos % 2
+
+	pixX := (output/l.Stack)*l.Clocks() + x
+	pixY := (output%l.Stack)*l.PanelHeight + half*l.Scan + rowSel
+
+	return stride*pixY + 4*pixX
+}
+
+// repeatCycle copies the first PWM cycles, of the given number of
+// frames, through the used frames of an encoded bank, and blanks the
+// frames after them.
+func (l *Layout) repeatCycle(dps []DoublePixel, frames, used int) {
+	cycle := frames * l.FrameSize()
+	end := used * l.FrameSize()
+	for off := cycle; off < end; off += cycle {
+		copy(dps[off:end], dps[:cycle])
+	}
+	clear(dps[end : l.FramesPerBank()*l.FrameSize()])
+}
+
+// pixels returns the FrameBank as a flat array, so that frames of
+// any Layout can be addressed.  For the DefaultLayout this is
+// identical to indexing fb[frame][rowSel][x].
+func (fb *FrameBank) pixels() []DoublePixel {
+	return unsafe.Slice(&fb[0][0][0], bankPixels)
+}
@@ -0,0 +1,136 @@
+package gpixio
+
+import (
+	"fmt"
+)
+
+// release is the fraction of the way back to full brightness that
+// the limiter recovers per encoded bank, once the load allows.
+const release = 0.125
+
+// PowerLimit configures the estimate of current drawn by the panels
+// and the limit placed on it.
+type PowerLimit struct {
+	// AmpsPerLED is the current through one LED channel while
+	// it is lit.  Zero disables the estimate.
+	AmpsPerLED float64
+
+	// Amps limits the total estimate, summed over outputs.  Zero
+	// is no limit.
+	Amps float64
+
+	// OutputAmps limits the estimate of each output.  Zero is no
+	// limit.
+	OutputAmps float64
+}
+
+// Power is the estimated current drawn by the most recently encoded
+// bank, in amps.  It is read with Buffer.Power, as receivers'
+// statistics are read with Stats; ledctrl logs it.
+type Power struct {
+	Outputs []float64
+	Total   float64
+
+	// Peak is the largest Total since the limit was set.
+	Peak float64
+
+	// Scale is the brightness, in (0, 1], at which the limiter
+	// encoded the bank.
+	Scale float64
+}
+
+// SetPowerLimit configures the power estimate and limiter.  This
+// must not be called concurrently with encoding.
+func (b *Buffer) SetPowerLimit(p PowerLimit) error {
+	if p.AmpsPerLED < 0 || p.Amps < 0 || p.OutputAmps < 0 {
+		return fmt.Errorf("negative power limit: %+v", p)
+	}
+	b.limit = p
+	b.scale = 1
+	b.ceiling = 0
+
+	b.powerMu.Lock()
+	defer b.powerMu.Unlock()
+	b.power.Peak = 0
+	b.power.Scale = 1
+	return nil
+}
+
+// Power returns the estimate for the most recently encoded bank.
+// This is safe to call concurrently with encoding.
+func (b *Buffer) Power() Power {
+	b.powerMu.Lock()
+	defer b.powerMu.Unlock()
+	p := b.power
+	p.Outputs = append([]float64(nil), b.power.Outputs...)
+	return p
+}
+
+// account turns the lit time slices counted for a bank of the given
+// number of distinct PWM cycles into the power estimate.  If the bank
+// exceeds the limit, it lowers the brightness and returns false, for
+// the bank to be encoded again.  Otherwise it records the estimate,
+// sets the brightness for the next bank, and returns true.  Every
+// frame is displayed for the same time and each row of a frame for
+// 1/Scan of it, so an output draws AmpsPerLED times its lit slices
+// per frame and row.  The blank frames after the last whole cycle
+// draw nothing.
+func (b *Buffer) account(st *bankState, cycles int) bool {
+	l := &b.layout
+	perSlice := b.limit.AmpsPerLED * float64(l.cycleFrames(b.depth)) /
+		float64(cycles<<b.depth*l.Scan*l.FramesPerBank())
+
+	var outputs [maxOutputs]float64
+	total, worst := 0.0, 0.0
+	for output := 0; output < l.Outputs; output++ {
+		lit := 0
+		for rowSel := range st.lit {
+			lit += st.lit[rowSel][output]
+		}
+		outputs[output] = float64(lit) * perSlice
+		total += outputs[output]
+		if outputs[output] > worst {
+			worst = outputs[output]
+		}
+	}
+
+	// The estimate is roughly proportional to the brightness
+	// encoded, so the limit on the demand at full brightness is a
+	// ratio.  Cut to it at once, to protect the supply, at least
+	// by a step so that rounding cannot keep the bank over the
+	// limit, but recover gradually so that a briefly bright frame
+	// does not pump the brightness.  Since the estimate is not
+	// quite proportional, recovery stops a step below the
+	// brightness at which the unchanged image was over the limit,
+	// rather than alternate between the two.
+	scale := b.selected.scale
+	if st.changed {
+		b.ceiling = 0
+	}
+	target := 1.0
+	if b.limit.Amps > 0 && total*target > b.limit.Amps*scale {
+		target = b.limit.Amps * scale / total
+	}
+	if b.limit.OutputAmps > 0 && worst*target > b.limit.OutputAmps*scale {
+		target = b.limit.OutputAmps * scale / worst
+	}
+	if target < scale {
+		b.ceiling = scale
+		b.scale = min(target, scale-1.0/scaleSteps)
+		return false
+	}
+	if b.ceiling > 0 {
+		target = min(target, b.ceiling-1.0/scaleSteps)
+	}
+	b.scale += (target - b.scale) * release
+
+	b.powerMu.Lock()
+	defer b.powerMu.Unlock()
+	copy(b.power.Outputs, outputs[:l.Outputs])
+	b.power.Total = total
+	if total > b.power.Peak {
+		b.power.Peak = total
+	}
+	b.power.Scale = scale
+	return true
+}
@@ -0,0 +1,108 @@
+package gpixio
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestPowerEstimate(t *testing.T) {
+	const amps = 0.01
+
+	for _, copy := range []func(*Buffer, *FrameBank){
+		func(b *Buffer, fb *FrameBank) { b.Copy0(Gamma(1), fb) },
+		func(b *Buffer, fb *FrameBank) { b.Copy1(Gamma(1), fb) },
+	} {
+		b := NewBuffer()
+		if err := b.SetPowerLimit(PowerLimit{AmpsPerLED: amps}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Lower half of J3 white; the rest black.
+		l := b.Layout()
+		draw.Draw(b.RGBA, image.Rect(0, 2*l.PanelHeight+l.Scan, l.Clocks(), 3*l.PanelHeight), image.White, image.Point{}, draw.Src)
+
+		var fb FrameBank
+		copy(b, &fb)
+		p := b.Power()
+
+		// 64 columns of one half, three channels, lit 63 of
+		// 64 frames.
+		want := amps * 64 * 3 * 63 / 64
+		for output, got := range p.Outputs {
+			w := 0.0
+			if output == 2 {
+				w = want
+			}
+			if math.Abs(got-w) > 1e-9 {
+				t.Errorf("output %d: %f amps, want %f", output, got, w)
+			}
+		}
+		if math.Abs(p.Total-want) > 1e-9 || p.Peak != p.Total || p.Scale != 1 {
+			t.Errorf("power %+v", p)
+		}
+	}
+}
+
+func TestPowerLimit(t *testing.T) {
+	b := NewBuffer()
+	b.SetDither(DitherTemporal)
+
+	full := 8 * 0.01 * 2 * 64 * 3 * 63 / 64
+	if err := b.SetPowerLimit(PowerLimit{AmpsPerLED: 0.01, Amps: full / 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first bank over the limit is already limited.
+	var fb FrameBank
+	draw.Draw(b.RGBA, b.Bounds(), image.White, image.Point{}, draw.Src)
+	b.Copy1(Gamma(1), &fb)
+	p := b.Power()
+	if p.Scale > 0.5 || p.Scale < 0.49 || p.Total > full/2 || p.Total < full/2*0.98 {
+		t.Fatalf("first bank: %+v, limit %f", p, full/2)
+	}
+	if p.Peak != p.Total {
+		t.Errorf("peak %f, want %f", p.Peak, p.Total)
+	}
+	if dec := b.Decode(&fb); dec.Pix[0] > 128 {
+		t.Errorf("first bank decodes as %d", dec.Pix[0])
+	}
+
+	b.Copy1(Gamma(1), &fb)
+	if q := b.Power(); q.Scale < p.Scale || q.Total > full/2 {
+		t.Fatalf("limited bank: %+v, first %+v", q, p)
+	}
+
+	// A limit on each output holds as well.
+	if err := b.SetPowerLimit(PowerLimit{AmpsPerLED: 0.01, OutputAmps: full / 8 / 4}); err != nil {
+		t.Fatal(err)
+	}
+	b.Copy0(Gamma(1), &fb)
+	for output, amps := range b.Power().Outputs {
+		if amps > full/8/4+1e-9 {
+			t.Errorf("output %d draws %f, limit %f", output, amps, full/8/4)
+		}
+	}
+
+	if err := b.SetPowerLimit(PowerLimit{AmpsPerLED: 0.01, Amps: full / 2}); err != nil {
+		t.Fatal(err)
+	}
+	b.Copy1(Gamma(1), &fb)
+
+	// Recovery is gradual once the load allows, in steps of the
+	// encoded brightness.
+	draw.Draw(b.RGBA, b.Bounds(), image.Black, image.Point{}, draw.Src)
+	b.Copy1(Gamma(1), &fb)
+	limited := b.Power().Scale
+	b.Copy1(Gamma(1), &fb)
+	if p := b.Power(); p.Total != 0 || limited > 0.5 || math.Abs(p.Scale-(limited+(1-limited)*release)) > 1.0/scaleSteps {
+		t.Errorf("recovering bank: %+v", p)
+	}
+	for i := 0; i < 100; i++ {
+		b.Copy1(Gamma(1), &fb)
+	}
+	if p := b.Power(); p.Scale != 1 {
+		t.Errorf("recovered bank: %+v", p)
+	}
+}
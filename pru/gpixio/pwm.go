@@ -0,0 +1,103 @@
+package gpixio
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// MinDepth is the color depth of a 32-frame PWM cycle, for
+	// layouts whose bank holds fewer than 64 frames, e.g., 42 for
+	// three chained 64x64 1/32 scan panels.
+	MinDepth = 5
+
+	// DefaultDepth is the color depth of a 64-frame PWM cycle,
+	// which repeats four times in the DefaultLayout's bank.  A new
+	// Buffer uses it, or the greatest depth whose cycle fits in
+	// the bank if less.
+	DefaultDepth = 6
+
+	// MaxDepth is the color depth of a 256-frame PWM cycle, using
+	// every frame of the DefaultLayout's bank once.
+	MaxDepth = 8
+)
+
+// pwmPatterns holds, for each depth, the PWM pattern of every value
+// v < 1<<depth, i.e., v lit time slices out of 1<<depth spread as
+// evenly as possible.  The PRU displays every frame for the same
+// time, so spreading the slices (rather than grouping them into
+// weighted bit planes) lowers flicker at no cost.  Each pattern is
+// stored as groups of 64 slices, one uint64 per group, of which a
+// cycle shorter than 64 uses the low bits of one.
+var pwmPatterns = func() (p [MaxDepth + 1][]uint64) {
+	for depth := MinDepth; depth <= MaxDepth; depth++ {
+		n := 1 << depth
+		groups := groupsOf(depth)
+		words := make([]uint64, n*groups)
+
+		for v := 1; v < n; v++ {
+			stride := float64(n) / float64(v)
+			offset := 0.0
+			for j := 0; j < v; j++ {
+				s := int(offset)
+				words[v*groups+s/slices] |= 1 << (s % slices)
+				offset += stride
+			}
+
+			count := 0
+			for _, w := range words[v*groups : (v+1)*groups] {
+				count += bits.OnesCount64(w)
+			}
+			if count != v {
+				panic("bad logic")
+			}
+		}
+		p[depth] = words
+	}
+	return p
+}()
+
+// SetDepth selects the number of bits per color channel, between
+// MinDepth and MaxDepth.  The PWM cycle of 1<<depth frames must fit
+// in the bank, see Layout.FramesPerBank.  This must not be called
+// concurrently with encoding.
+func (b *Buffer) SetDepth(depth int) error {
+	if depth < MinDepth || depth > MaxDepth {
+		return fmt.Errorf("depth %d is not in [%d, %d]", depth, MinDepth, MaxDepth)
+	}
+	if frames := b.layout.FramesPerBank(); 1<<depth > frames {
+		return fmt.Errorf("depth %d needs %d frames, the bank has %d", depth, 1<<depth, frames)
+	}
+	b.depth = depth
+	return nil
+}
+
+// Depth returns the number of bits per color channel.
+func (b *Buffer) Depth() int {
+	return b.depth
+}
+
+// groups is the number of 64-frame groups in one PWM cycle.
+func (b *Buffer) groups() int {
+	return groupsOf(b.depth)
+}
+
+// groupFrames is the number of frames in each group of the PWM
+// cycle, fewer than 64 when the cycle is.
+func (b *Buffer) groupFrames() int {
+	return min(slices, 1<<b.depth)
+}
+
+func groupsOf(depth int) int {
+	return max(1, (1<<depth)/slices)
+}
+
+// fitDepth returns the greatest depth, up to DefaultDepth, whose PWM
+// cycle fits in a bank of the given number of frames.
+func fitDepth(frames int) int {
+	depth := DefaultDepth
+	for depth > MinDepth && 1<<depth > frames {
+		depth--
+	}
+	return depth
+}
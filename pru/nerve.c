@@ -391,7 +391,7 @@ void setup_param() {
   edma_param_entry->opt.tcc = dmaChannel;
 
   edma_param_entry->ccnt.ccnt = 1;
-  edma_param_entry->abcnt.acnt = 1 << 12;
+  edma_param_entry->abcnt.acnt = FRAMEBUF_PART_SIZE;
   edma_param_entry->abcnt.bcnt = 1;
   edma_param_entry->bidx.srcbidx = 0;
   edma_param_entry->bidx.dstbidx = 0;
@@ -469,12 +469,12 @@ uint32_t start_dma(uint32_t nextLocalIndex, uint32_t currentBank, uint32_t curre
 
   setup_param();
 
-  edma_param_entry->dst = PRU_L4_FAST_SHARED_PRUSS_MEM + (nextLocalIndex * FRAMEBUF_PART_SIZE);
+  edma_param_entry->dst = PRU_L4_FAST_SHARED_PRUSS_MEM + (nextLocalIndex * FRAMEBUF_LOCAL_SIZE);
   edma_param_entry->src = resourceTable.framebufs.pa + (currentBank * FRAMEBUF_BANK_SIZE) +
                           (currentFrame * FRAMEBUF_FRAME_SIZE) + (currentPart * FRAMEBUF_PART_SIZE);
 
   edma_param_entry->ccnt.ccnt = 1;
-  edma_param_entry->abcnt.acnt = 1 << 12;
+  edma_param_entry->abcnt.acnt = FRAMEBUF_PART_SIZE;
   edma_param_entry->abcnt.bcnt = 1;
   edma_param_entry->opt.tcc = dmaChannel;
 
@@ -657,7 +657,7 @@ void init_test_buffer() {
   // for some reason the DMA is not succesful, these pixels represent
   // rows 0-15 blue, rows 16-31 dark.
   for (row = 0; row < (2 * FRAMEBUF_SCANS_PER_PART); row++) {
-    for (pix = 0; pix < 64; pix++) {
+    for (pix = 0; pix < FRAMEBUF_WIDTH; pix++) {
       pixptr->gpv1.bits.rowSelect = row;
       pixptr->gpv1.bits.inputClock = 0;
       pixptr->gpv1.bits.outputEnable = 0;
@@ -740,7 +740,7 @@ void init_test_buffer() {
 
         // This draws a blue checkerboard pattern with alternating red
         // and green squares.
-        for (pix = 0; pix < 64; pix++) {
+        for (pix = 0; pix < FRAMEBUF_WIDTH; pix++) {
           pixptr->gpv1.bits.rowSelect = row;
           pixptr->gpv1.bits.inputClock = 0;
           pixptr->gpv1.bits.outputEnable = 0;
@@ -852,6 +852,8 @@ control_t *setup_controls() {
   memset(global_ctrl, 0, sizeof(control_t));
   global_ctrl->framebufs_addr = resourceTable.framebufs.pa;
   global_ctrl->framebufs_size = FRAMEBUF_TOTAL_SIZE;
+  global_ctrl->framebuf_scans = FRAMEBUF_SCANS;
+  global_ctrl->framebuf_width = FRAMEBUF_WIDTH;
   return global_ctrl;
 }
 
@@ -872,7 +874,7 @@ void main(void) {
   frame_banks[1] = (dbl_pixel_t *)(resourceTable.framebufs.pa + FRAMEBUF_BANK_SIZE);
 
   local_banks[0] = (dbl_pixel_t *)0x10000;
-  local_banks[1] = (dbl_pixel_t *)0x11000;
+  local_banks[1] = (dbl_pixel_t *)(0x10000 + FRAMEBUF_LOCAL_SIZE);
 
   uint32_t unused;
 
@@ -908,7 +910,7 @@ void main(void) {
 
           uint32_t pix;
           // For 64 pixels width
-          for (pix = 0; pix < 64; pix++) {
+          for (pix = 0; pix < FRAMEBUF_WIDTH; pix++) {
 
             // Set 2 pixels
             setPix(pixptr++);
@@ -0,0 +1,62 @@
+package sacn
+
+import (
+	"fmt"
+)
+
+// Config places the pixels of a frame in universes.  The frame is
+// the RGB channels of every pixel, in row-major order, starting at
+// StartChannel of universe StartUniverse and continuing through
+// consecutive universes of ChannelsPerUniverse channels.
+type Config struct {
+	// StartUniverse is the first universe, from 1.
+	StartUniverse uint16
+
+	// ChannelsPerUniverse is the number of channels used in each
+	// universe, at most 512.
+	ChannelsPerUniverse int
+
+	// StartChannel is the 0-based channel of the first pixel in
+	// the first universe.
+	StartChannel int
+}
+
+// DefaultConfig packs 170 pixels into each universe starting at
+// universe 1, as Sender does.
+var DefaultConfig = Config{
+	StartUniverse:       1,
+	ChannelsPerUniverse: 3 * maxPerPacket,
+	StartChannel:        0,
+}
+
+// Validate checks that the configuration is usable.
+func (c Config) Validate() error {
+	if c.StartUniverse < 1 || c.StartUniverse > MaxUniverse {
+		return fmt.Errorf("start universe %d is not in [1, %d]", c.StartUniverse, MaxUniverse)
+	}
+	if c.ChannelsPerUniverse < 3 || c.ChannelsPerUniverse > dmxChannels {
+		return fmt.Errorf("channels per universe %d is not in [3, %d]", c.ChannelsPerUniverse, dmxChannels)
+	}
+	if c.StartChannel < 0 || c.StartChannel >= c.ChannelsPerUniverse {
+		return fmt.Errorf("start channel %d is not in [0, %d)", c.StartChannel, c.ChannelsPerUniverse)
+	}
+	return nil
+}
+
+// Universes returns the number of universes a frame of the given
+// number of pixels spans.
+func (c Config) Universes(pixels int) int {
+	return (c.StartChannel + 3*pixels + c.ChannelsPerUniverse - 1) / c.ChannelsPerUniverse
+}
+
+// check returns an error if the frame does not fit below the
+// largest universe.
+func (c Config) check(pixels int) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if last := int(c.StartUniverse) + c.Universes(pixels) - 1; last > MaxUniverse {
+		return fmt.Errorf("%d pixels from universe %d exceed the largest universe", pixels, c.StartUniverse)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package sacn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	// Port is the E1.31 UDP port.
+	Port = 5568
+
+	// MaxUniverse is the largest universe number for data.
+	MaxUniverse = 63999
+
+	// DiscoveryUniverse is the universe of the discovery packets
+	// that sources send every discoveryInterval.
+	DiscoveryUniverse = 64214
+
+	// DefaultPriority is the priority of a source that doesn't
+	// say otherwise.  Receivers use the source of the highest
+	// priority, up to MaxPriority.
+	DefaultPriority = 100
+	MaxPriority     = 200
+
+	// Root and framing layer vectors.
+	vectorRootData          = 0x00000004
+	vectorRootExtended      = 0x00000008
+	vectorFramingData       = 0x00000002
+	vectorExtendedSync      = 0x00000001
+	vectorExtendedDiscovery = 0x00000002
+	vectorDMP               = 0x02
+	vectorDiscoveryList     = 0x00000001
+
+	// Framing options.
+	optionPreview    = 0x80
+	optionTerminated = 0x40
+
+	// Sizes of the packets, less data or universe lists.
+	dataHeader      = 126
+	syncSize        = 49
+	discoveryHeader = 120
+
+	dmxChannels        = 512
+	sourceNameLen      = 64
+	discoveryUniverses = 512
+
+	discoveryInterval = 10 * time.Second
+
+	// dataLossTimeout is how long a source may be silent before
+	// receivers stop waiting for it.
+	dataLossTimeout = 2500 * time.Millisecond
+)
+
+// acnID identifies the root layer of ACN packets.
+var acnID = [12]byte{'A', 'S', 'C', '-', 'E', '1', '.', '1', '7'}
+
+// errSkip marks packets that are valid but of no interest, such as
+// those with alternate start codes.
+var errSkip = errors.New("skip")
+
+type kind int
+
+const (
+	kindData kind = iota
+	kindSync
+	kindDiscovery
+)
+
+// message is a decoded packet of any kind.
+type message struct {
+	kind kind
+	cid  [16]byte
+
+	// Data and discovery packets.
+	source string
+
+	// Data packets.
+	priority uint8
+	seq      uint8
+	options  uint8
+	universe uint16
+	data     []byte
+
+	// Data and sync packets: the universe of the sync packets
+	// that data packets wait for, or zero.
+	sync uint16
+
+	// Discovery packets.
+	page, last uint8
+	universes  []uint16
+}
+
+// Multicast returns the group address of a universe.
+func Multicast(universe uint16) *net.UDPAddr {
+	return &net.UDPAddr{
+		IP:   net.IPv4(239, 255, byte(universe>>8), byte(universe)),
+		Port: Port,
+	}
+}
+
+// putLayer writes the flags and length of the layer starting at off,
+// which extends to the end of b.
+func putLayer(b []byte, off int) {
+	binary.BigEndian.PutUint16(b[off:], 0x7000|uint16(len(b)-off))
+}
+
+// putRoot writes the root layer.
+func putRoot(b []byte, vector uint32, cid [16]byte) {
+	binary.BigEndian.PutUint16(b[0:], 0x0010)
+	binary.BigEndian.PutUint16(b[2:], 0)
+	copy(b[4:16], acnID[:])
+	putLayer(b, 16)
+	binary.BigEndian.PutUint32(b[18:], vector)
+	copy(b[22:38], cid[:])
+}
+
+// putName writes a NUL-terminated source name.
+func putName(b []byte, name string) {
+	n := copy(b[:sourceNameLen-1], name)
+	for i := n; i < sourceNameLen; i++ {
+		b[i] = 0
+	}
+}
+
+// encodeData writes a data packet for the channels of one universe
+// into b, returning the packet.
+func encodeData(b []byte, cid [16]byte, m *message) []byte {
+	b = b[:dataHeader+len(m.data)]
+	putRoot(b, vectorRootData, cid)
+
+	putLayer(b, 38)
+	binary.BigEndian.PutUint32(b[40:], vectorFramingData)
+	putName(b[44:], m.source)
+	b[108] = m.priority
+	binary.BigEndian.PutUint16(b[109:], m.sync)
+	b[111] = m.seq
+	b[112] = m.options
+	binary.BigEndian.PutUint16(b[113:], m.universe)
+
+	putLayer(b, 115)
+	b[117] = vectorDMP
+	b[118] = 0xa1
+	binary.BigEndian.PutUint16(b[119:], 0)
+	binary.BigEndian.PutUint16(b[121:], 1)
+	binary.BigEndian.PutUint16(b[123:], uint16(1+len(m.data)))
+	b[125] = 0
+	copy(b[dataHeader:], m.data)
+	return b
+}
+
+// encodeSync writes a sync packet.
+func encodeSync(b []byte, cid [16]byte, seq uint8, sync uint16) []byte {
+	b = b[:syncSize]
+	putRoot(b, vectorRootExtended, cid)
+	putLayer(b, 38)
+	binary.BigEndian.PutUint32(b[40:], vectorExtendedSync)
+	b[44] = seq
+	binary.BigEndian.PutUint16(b[45:], sync)
+	binary.BigEndian.PutUint16(b[47:], 0)
+	return b
+}
+
+// encodeDiscovery returns the discovery packets listing universes.
+func encodeDiscovery(cid [16]byte, source string, universes []uint16) [][]byte {
+	sorted := append([]uint16(nil), universes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	pages := (len(sorted) + discoveryUniverses - 1) / discoveryUniverses
+	if pages == 0 {
+		pages = 1
+	}
+	var pkts [][]byte
+	for page := 0; page < pages; page++ {
+		list := sorted[page*discoveryUniverses:]
+		if len(list) > discoveryUniverses {
+			list = list[:discoveryUniverses]
+		}
+		b := make([]byte, discoveryHeader+2*len(list))
+		putRoot(b, vectorRootExtended, cid)
+		putLayer(b, 38)
+		binary.BigEndian.PutUint32(b[40:], vectorExtendedDiscovery)
+		putName(b[44:], source)
+
+		putLayer(b, 112)
+		binary.BigEndian.PutUint32(b[114:], vectorDiscoveryList)
+		b[118] = uint8(page)
+		b[119] = uint8(pages - 1)
+		for i, u := range list {
+			binary.BigEndian.PutUint16(b[discoveryHeader+2*i:], u)
+		}
+		pkts = append(pkts, b)
+	}
+	return pkts
+}
+
+// layer checks the flags and length of the layer starting at off,
+// which must extend to the end of b.
+func layer(b []byte, off int) error {
+	if binary.BigEndian.Uint16(b[off:])&0x0fff != uint16(len(b)-off) {
+		return fmt.Errorf("bad length at %d", off)
+	}
+	return nil
+}
+
+// decode parses a packet.  The data of a data packet refers to b.
+func decode(b []byte) (*message, error) {
+	if len(b) < syncSize {
+		return nil, fmt.Errorf("short packet: %d bytes", len(b))
+	}
+	if binary.BigEndian.Uint16(b[0:]) != 0x0010 || !bytes.Equal(b[4:16], acnID[:]) {
+		return nil, errors.New("not an ACN packet")
+	}
+	if err := layer(b, 16); err != nil {
+		return nil, err
+	}
+	m := &message{}
+	copy(m.cid[:], b[22:38])
+
+	if err := layer(b, 38); err != nil {
+		return nil, err
+	}
+	root := binary.BigEndian.Uint32(b[18:])
+	framing := binary.BigEndian.Uint32(b[40:])
+	switch {
+	case root == vectorRootData && framing == vectorFramingData:
+		return m, m.decodeData(b)
+	case root == vectorRootExtended && framing == vectorExtendedSync:
+		m.kind = kindSync
+		m.seq = b[44]
+		m.sync = binary.BigEndian.Uint16(b[45:])
+		return m, nil
+	case root == vectorRootExtended && framing == vectorExtendedDiscovery:
+		return m, m.decodeDiscovery(b)
+	}
+	return nil, fmt.Errorf("unknown vectors %#x, %#x", root, framing)
+}
+
+func (m *message) decodeData(b []byte) error {
+	if len(b) < dataHeader || len(b) > dataHeader+dmxChannels {
+		return fmt.Errorf("data packet of %d bytes", len(b))
+	}
+	m.kind = kindData
+	m.source = cString(b[44 : 44+sourceNameLen])
+	m.priority = b[108]
+	m.sync = binary.BigEndian.Uint16(b[109:])
+	m.seq = b[111]
+	m.options = b[112]
+	m.universe = binary.BigEndian.Uint16(b[113:])
+
+	if err := layer(b, 115); err != nil {
+		return err
+	}
+	if b[117] != vectorDMP || b[118] != 0xa1 ||
+		binary.BigEndian.Uint16(b[119:]) != 0 ||
+		binary.BigEndian.Uint16(b[121:]) != 1 ||
+		int(binary.BigEndian.Uint16(b[123:])) != len(b)-dataHeader+1 {
+		return errors.New("bad DMP layer")
+	}
+	if b[125] != 0 {
+		return errSkip
+	}
+	m.data = b[dataHeader:]
+	return nil
+}
+
+func (m *message) decodeDiscovery(b []byte) error {
+	if len(b) < discoveryHeader || (len(b)-discoveryHeader)%2 != 0 {
+		return fmt.Errorf("discovery packet of %d bytes", len(b))
+	}
+	if err := layer(b, 112); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(b[114:]) != vectorDiscoveryList {
+		return errors.New("bad discovery layer")
+	}
+	m.kind = kindDiscovery
+	m.source = cString(b[44 : 44+sourceNameLen])
+	m.page = b[118]
+	m.last = b[119]
+	for o := discoveryHeader; o < len(b); o += 2 {
+		m.universes = append(m.universes, binary.BigEndian.Uint16(b[o:]))
+	}
+	return nil
+}
+
+// cString returns the text of a NUL-terminated field.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,436 @@
+package sacn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmacd/nerve/pru/frame"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	receiverQueueLen = 1000
+	maxPacketSize    = 1024
+	maxPerPacket     = 170
+
+	// seqWindow is how far back a sequence number may be and
+	// still be taken as out of order, per the E1.31 standard.
+	seqWindow = 20
+
+	// maxSources limits the sources found by discovery, as a flood
+	// of spoofed CIDs could otherwise exhaust memory.  Discovery
+	// packets from more are ignored.
+	maxSources = 64
+)
+
+// Source is a sender found by universe discovery.
+type Source struct {
+	CID       [16]byte
+	Name      string
+	Universes []uint16
+
+	seen time.Time
+}
+
+// ReceiveStats describes what a Receiver has received.
+type ReceiveStats struct {
+	// Frames counts the complete frames, and Incomplete those
+	// abandoned because a universe arrived twice before the rest,
+	// i.e., a packet was lost.
+	Frames     uint64
+	Incomplete uint64
+}
+
+// CompletionRate returns the fraction of frames begun that completed.
+func (s ReceiveStats) CompletionRate() float64 {
+	if s.Frames+s.Incomplete == 0 {
+		return 0
+	}
+	return float64(s.Frames) / float64(s.Frames+s.Incomplete)
+}
+
+// stream is the source whose data a universe is taking.
+type stream struct {
+	cid      [16]byte
+	priority uint8
+	seq      uint8
+	last     time.Time
+}
+
+type Receiver struct {
+	conn  *net.UDPConn
+	group *ipv4.PacketConn
+	iface *net.Interface
+	in    *image.RGBA
+	wg    sync.WaitGroup
+
+	// cfg places the frame in universes, of which got marks those
+	// received for the frame in progress, missing counts the rest.
+	// streams selects the source of each universe.
+	cfg     Config
+	pixels  int
+	got     []bool
+	missing int
+	streams []stream
+	joined  map[uint16]bool
+
+	// While sync packets arrive, a complete frame is held until
+	// the next one for syncAddr, the universe the data names.
+	// lastSync is when the last arrived, and pending is set while
+	// held is waiting.
+	syncAddr uint16
+	held     *image.RGBA
+	pending  bool
+	lastSync time.Time
+	now      func() time.Time
+
+	// mu protects the discovered sources, last expired at
+	// lastExpire, and the statistics.
+	mu         sync.Mutex
+	sources    map[[16]byte]*Source
+	lastExpire time.Time
+	stats      ReceiveStats
+
+	// The decoder fills in without locking, then publishes it to
+	// the Buffer (by way of held, when synchronized).
+	*frame.Buffer
+}
+
+// NewReceiver returns a Receiver of frames in the DefaultConfig.
+func NewReceiver(hostIP string, out *image.RGBA) (*Receiver, error) {
+	return NewReceiverConfig(hostIP, out, DefaultConfig)
+}
+
+// NewReceiverConfig returns a Receiver of frames the size of out,
+// placed in universes by cfg.  It joins the multicast groups of the
+// universes, and of discovery, on the interface with address hostIP,
+// or the default interface if hostIP is unspecified.  Unicast
+// packets are received too.
+func NewReceiverConfig(hostIP string, out *image.RGBA, cfg Config) (*Receiver, error) {
+	if err := cfg.check(out.Rect.Dx() * out.Rect.Dy()); err != nil {
+		return nil, err
+	}
+	iface, err := interfaceOf(hostIP)
+	if err != nil {
+		return nil, err
+	}
+	// Multicast is only received by sockets bound to the wildcard
+	// address.
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: Port})
+	if err != nil {
+		fmt.Printf("error opening udp: %s\n", err)
+		return nil, err
+	}
+	r := newReceiver(conn, out, cfg)
+	r.group = ipv4.NewPacketConn(conn)
+	r.iface = iface
+
+	if err := r.join(DiscoveryUniverse); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for u := range r.streams {
+		if err := r.join(cfg.StartUniverse + uint16(u)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func newReceiver(conn *net.UDPConn, out *image.RGBA, cfg Config) *Receiver {
+	pixels := out.Rect.Dx() * out.Rect.Dy()
+	n := cfg.Universes(pixels)
+	r := &Receiver{
+		conn:    conn,
+		in:      image.NewRGBA(out.Bounds()),
+		held:    image.NewRGBA(out.Bounds()),
+		now:     time.Now,
+		cfg:     cfg,
+		pixels:  pixels,
+		got:     make([]bool, n),
+		streams: make([]stream, n),
+		joined:  map[uint16]bool{},
+		sources: map[[16]byte]*Source{},
+		Buffer:  frame.NewBuffer(out),
+	}
+	r.reset()
+	return r
+}
+
+// interfaceOf returns the interface with an IP address, or nil for
+// the default.
+func interfaceOf(hostIP string) (*net.Interface, error) {
+	ip := net.ParseIP(hostIP)
+	if ip == nil || ip.IsUnspecified() {
+		return nil, nil
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has address %s", hostIP)
+}
+
+// join joins the multicast group of a universe, once.
+func (r *Receiver) join(universe uint16) error {
+	if r.group == nil || r.joined[universe] {
+		return nil
+	}
+	if err := r.group.JoinGroup(r.iface, Multicast(universe)); err != nil {
+		return fmt.Errorf("join universe %d: %w", universe, err)
+	}
+	r.joined[universe] = true
+	return nil
+}
+
+func (r *Receiver) Start(ctx context.Context) error {
+	recvCh := make(chan []byte, receiverQueueLen)
+	r.wg.Add(2)
+
+	go func() {
+		defer r.wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, _, err := r.conn.ReadFromUDP(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				fmt.Printf("error reading packet: %s\n", err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case recvCh <- buf[:n]:
+				buf = make([]byte, maxPacketSize)
+			}
+		}
+	}()
+
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case b := <-recvCh:
+				r.handle(b)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// handle decodes one packet.
+func (r *Receiver) handle(b []byte) {
+	m, err := decode(b)
+	if err == errSkip {
+		return
+	}
+	if err != nil {
+		fmt.Printf("sacn: %s\n", err)
+		return
+	}
+	switch m.kind {
+	case kindData:
+		r.data(m)
+	case kindSync:
+		r.sync(m)
+	case kindDiscovery:
+		r.discover(m)
+	}
+}
+
+// accept decides whether to take data for a universe from a source.
+// The source of the highest priority wins, and keeps the universe
+// until it stops sending or terminates the stream.  Packets older
+// than the last one taken are dropped.
+func (r *Receiver) accept(st *stream, m *message) bool {
+	now := r.now()
+	active := !st.last.IsZero() && now.Sub(st.last) < dataLossTimeout
+
+	switch {
+	case !active || m.priority > st.priority && m.cid != st.cid:
+		if m.options&optionTerminated != 0 {
+			return false
+		}
+		*st = stream{cid: m.cid}
+	case m.cid != st.cid:
+		return false
+	default:
+		if d := int8(m.seq - st.seq); d <= 0 && d > -seqWindow {
+			return false
+		}
+	}
+	if m.options&optionTerminated != 0 {
+		*st = stream{}
+		return false
+	}
+	st.priority = m.priority
+	st.seq = m.seq
+	st.last = now
+	return true
+}
+
+// data places the channels of one universe in the frame.  A universe
+// that arrives twice before the frame completes means a packet was
+// lost, and the frame starts over.
+func (r *Receiver) data(m *message) {
+	u := int(m.universe) - int(r.cfg.StartUniverse)
+	if u < 0 || u >= len(r.got) || m.options&optionPreview != 0 {
+		return
+	}
+	if !r.accept(&r.streams[u], m) {
+		return
+	}
+	if m.sync != r.syncAddr {
+		r.syncAddr = m.sync
+		if m.sync != 0 {
+			if err := r.join(m.sync); err != nil {
+				fmt.Printf("sacn: %s\n", err)
+			}
+		}
+	}
+	if r.got[u] {
+		r.count(func(st *ReceiveStats) { st.Incomplete++ })
+		r.reset()
+	}
+	r.got[u] = true
+	r.missing--
+
+	// Frame channel k holds universe channel 0, which may be
+	// before the frame (k < 0).
+	cpu := r.cfg.ChannelsPerUniverse
+	data := m.data
+	if len(data) > cpu {
+		data = data[:cpu]
+	}
+	frame.Channels(r.in.Pix, u*cpu-r.cfg.StartChannel, cpu, data)
+
+	if r.missing == 0 {
+		r.complete()
+		r.reset()
+	}
+}
+
+// complete publishes the frame in r.in, or holds it for a sync
+// packet if the data asks for one and one has arrived recently.
+func (r *Receiver) complete() {
+	r.count(func(st *ReceiveStats) { st.Frames++ })
+	if r.syncAddr != 0 && !r.lastSync.IsZero() && r.now().Sub(r.lastSync) < dataLossTimeout {
+		r.in, r.held = r.held, r.in
+		r.pending = true
+		return
+	}
+	r.in = r.Publish(r.in)
+}
+
+// sync publishes the held frame.
+func (r *Receiver) sync(m *message) {
+	if m.sync != r.syncAddr {
+		return
+	}
+	r.lastSync = r.now()
+	if r.pending {
+		r.held = r.Publish(r.held)
+		r.pending = false
+	}
+}
+
+// Stats returns what the Receiver has received so far.
+func (r *Receiver) Stats() ReceiveStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// count updates the statistics of the Receiver.
+func (r *Receiver) count(f func(st *ReceiveStats)) {
+	r.mu.Lock()
+	f(&r.stats)
+	r.mu.Unlock()
+}
+
+// reset starts a new frame.
+func (r *Receiver) reset() {
+	for i := range r.got {
+		r.got[i] = false
+	}
+	r.missing = len(r.got)
+}
+
+// discover records a page of a source's universe list.
+func (r *Receiver) discover(m *message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.lastExpire) >= discoveryInterval {
+		r.expire(now)
+	}
+	s := r.sources[m.cid]
+	if s == nil {
+		if len(r.sources) >= maxSources {
+			return
+		}
+		s = &Source{CID: m.cid}
+		r.sources[m.cid] = s
+	}
+	if m.page == 0 {
+		s.Universes = s.Universes[:0]
+	}
+	s.Name = m.source
+	// A list repeating its later pages can't outgrow the universes.
+	if len(s.Universes)+len(m.universes) <= MaxUniverse {
+		s.Universes = append(s.Universes, m.universes...)
+	}
+	s.seen = now
+}
+
+// expire forgets the sources not heard from by discovery for two
+// intervals.
+func (r *Receiver) expire(now time.Time) {
+	r.lastExpire = now
+	for cid, s := range r.sources {
+		if now.Sub(s.seen) > 2*discoveryInterval {
+			delete(r.sources, cid)
+		}
+	}
+}
+
+// Sources returns the senders heard from by universe discovery
+// recently, by name.
+func (r *Receiver) Sources() []Source {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(r.now())
+	var list []Source
+	for _, s := range r.sources {
+		c := *s
+		c.Universes = append([]uint16(nil), s.Universes...)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
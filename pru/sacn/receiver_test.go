@@ -0,0 +1,305 @@
+package sacn
+
+import (
+	"image"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func randomImage(seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0
+	}
+	return img
+}
+
+// dataPackets encodes img as the Sender does, from a source with the
+// given CID and priority.
+func dataPackets(img *image.RGBA, cid byte, priority, seq uint8, sync uint16) (pkts [][]byte) {
+	m := message{priority: priority, seq: seq, sync: sync, universe: DefaultConfig.StartUniverse}
+	pixels := img.Rect.Dx() * img.Rect.Dy()
+	for p := 0; p < pixels; p += maxPerPacket {
+		var data []byte
+		for i := 0; i < maxPerPacket && p+i < pixels; i++ {
+			data = append(data, img.Pix[4*(p+i):4*(p+i)+3]...)
+		}
+		m.data = data
+		pkts = append(pkts, encodeData(make([]byte, maxPacketSize), [16]byte{cid}, &m))
+		m.universe++
+	}
+	return pkts
+}
+
+func TestPacket(t *testing.T) {
+	m := message{
+		source:   "test source",
+		priority: 150,
+		sync:     7,
+		seq:      42,
+		options:  optionPreview,
+		universe: 1234,
+		data:     []byte{1, 2, 3, 4},
+	}
+	cid := [16]byte{1, 2, 3}
+	d, err := decode(encodeData(make([]byte, maxPacketSize), cid, &m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.kind != kindData || d.cid != cid || d.source != m.source || d.priority != m.priority ||
+		d.sync != m.sync || d.seq != m.seq || d.options != m.options || d.universe != m.universe ||
+		string(d.data) != string(m.data) {
+		t.Errorf("data packet %+v", d)
+	}
+
+	d, err = decode(encodeSync(make([]byte, maxPacketSize), cid, 9, 7))
+	if err != nil || d.kind != kindSync || d.seq != 9 || d.sync != 7 {
+		t.Errorf("sync packet %+v %v", d, err)
+	}
+
+	var universes []uint16
+	for u := 600; u > 0; u-- {
+		universes = append(universes, uint16(u))
+	}
+	pkts := encodeDiscovery(cid, "disco", universes)
+	if len(pkts) != 2 {
+		t.Fatalf("%d discovery pages", len(pkts))
+	}
+	var all []uint16
+	for i, b := range pkts {
+		d, err := decode(b)
+		if err != nil || d.kind != kindDiscovery || d.source != "disco" || int(d.page) != i || d.last != 1 {
+			t.Fatalf("discovery packet %+v %v", d, err)
+		}
+		all = append(all, d.universes...)
+	}
+	for i, u := range all {
+		if int(u) != i+1 {
+			t.Fatalf("discovery universes %v", all)
+		}
+	}
+
+	// Alternate start codes are ignored.
+	b := encodeData(make([]byte, maxPacketSize), cid, &m)
+	b[125] = 0xdd
+	if _, err := decode(b); err != errSkip {
+		t.Errorf("alternate start code: %v", err)
+	}
+}
+
+func TestReceiverPriority(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	send := func(img *image.RGBA, cid byte, priority, seq uint8) {
+		for _, b := range dataPackets(img, cid, priority, seq, 0) {
+			r.handle(b)
+		}
+	}
+	low, high := randomImage(1), randomImage(2)
+
+	send(low, 1, 100, 0)
+	if seq := r.Draw(); seq != 1 || string(out.Pix) != string(low.Pix) {
+		t.Fatalf("first source: sequence %d", seq)
+	}
+
+	// A higher priority source takes over, and a lower one is
+	// then ignored.
+	send(high, 2, 150, 0)
+	send(low, 1, 100, 1)
+	if seq := r.Draw(); seq != 2 || string(out.Pix) != string(high.Pix) {
+		t.Fatalf("higher priority: sequence %d", seq)
+	}
+
+	// Repeated and older sequence numbers are dropped.
+	send(low, 2, 150, 0)
+	send(low, 2, 150, 250)
+	if seq := r.Sequence(); seq != 2 {
+		t.Fatalf("old sequence numbers: sequence %d", seq)
+	}
+	// But a large jump back is a restart.
+	send(low, 2, 150, 200)
+	if seq := r.Sequence(); seq != 3 {
+		t.Fatalf("restarted source: sequence %d", seq)
+	}
+
+	// When the high priority source goes quiet, the low one
+	// takes over.
+	now = now.Add(dataLossTimeout)
+	send(high, 1, 100, 2)
+	if seq := r.Draw(); seq != 4 || string(out.Pix) != string(high.Pix) {
+		t.Fatalf("after data loss: sequence %d", seq)
+	}
+
+	// A terminated stream frees the universe immediately.
+	m := message{priority: 100, seq: 3, options: optionTerminated, universe: 1}
+	r.handle(encodeData(make([]byte, maxPacketSize), [16]byte{1}, &m))
+	if r.streams[0].last != (time.Time{}) {
+		t.Error("stream not terminated")
+	}
+}
+
+func TestReceiverSync(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	sync := encodeSync(make([]byte, maxPacketSize), [16]byte{1}, 0, 7)
+
+	var seq uint8
+	frame := func(seed int64) *image.RGBA {
+		img := randomImage(seed)
+		for _, b := range dataPackets(img, 1, 100, seq, 7) {
+			r.handle(b)
+		}
+		seq++
+		return img
+	}
+
+	// Before any sync packet, frames are delivered when complete.
+	frame(1)
+	if r.Sequence() != 1 {
+		t.Fatal("unsynchronized frame not delivered")
+	}
+	r.handle(sync)
+
+	// Then, complete frames wait for the next sync packet.
+	img := frame(2)
+	if r.Sequence() != 1 {
+		t.Fatal("frame delivered before sync")
+	}
+	r.handle(sync)
+	if seq := r.Draw(); seq != 2 || string(out.Pix) != string(img.Pix) {
+		t.Fatalf("synchronized frame: sequence %d", seq)
+	}
+}
+
+func TestReceiverStats(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+
+	// The second packet of a frame is lost, so its first
+	// arrives again before the frame completes.
+	lossy := dataPackets(randomImage(1), 1, 100, 0, 0)
+	r.handle(lossy[0])
+	for _, b := range dataPackets(randomImage(2), 1, 100, 1, 0) {
+		r.handle(b)
+	}
+	if st := r.Stats(); st.Frames != 1 || st.Incomplete != 1 || st.CompletionRate() != 0.5 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestReceiverSources(t *testing.T) {
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	discover := func(id int, universes []uint16) {
+		var cid [16]byte
+		cid[0], cid[1] = uint8(id), uint8(id>>8)
+		for _, b := range encodeDiscovery(cid, "source", universes) {
+			r.handle(b)
+		}
+	}
+
+	// A flood of spoofed CIDs is tracked to a limit, without
+	// asking for the Sources.
+	for id := 0; id < 2*maxSources; id++ {
+		discover(id, []uint16{1})
+	}
+	if n := len(r.sources); n != maxSources {
+		t.Fatalf("%d sources", n)
+	}
+
+	// Silent sources are forgotten as others are discovered.
+	now = now.Add(discoveryInterval)
+	discover(1, []uint16{1, 2})
+	now = now.Add(2 * discoveryInterval)
+	discover(2, []uint16{3})
+	if n := len(r.sources); n != 2 {
+		t.Fatalf("%d sources after expiry", n)
+	}
+
+	// A source repeating the last page of its list doesn't grow
+	// it past the universes.
+	universes := make([]uint16, 2*discoveryUniverses)
+	for i := range universes {
+		universes[i] = uint16(i + 1)
+	}
+	pages := encodeDiscovery([16]byte{3}, "pages", universes)
+	r.handle(pages[0])
+	for i := 0; i < 2*MaxUniverse/discoveryUniverses; i++ {
+		r.handle(pages[1])
+	}
+	if n := len(r.sources[[16]byte{3}].Universes); n > MaxUniverse {
+		t.Errorf("%d universes", n)
+	}
+
+	sources := r.Sources()
+	if len(sources) != 3 || sources[0].Name != "pages" || len(sources[1].Universes)+len(sources[2].Universes) != 3 {
+		t.Errorf("%d sources", len(sources))
+	}
+}
+
+func TestSender(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := NewSender("127.0.0.1")
+	s.port = conn.LocalAddr().(*net.UDPAddr).Port
+	s.Name = "sender test"
+	s.SyncUniverse = 7
+
+	out := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	r := newReceiver(nil, out, DefaultConfig)
+	buf := make([]byte, maxPacketSize)
+	receive := func(n int) {
+		for i := 0; i < n; i++ {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.handle(buf[:n])
+		}
+	}
+
+	// Four universes, sync, and discovery the first time.
+	for i := int64(0); i < 3; i++ {
+		src := randomImage(i)
+		if err := s.Send(src); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			receive(6)
+		} else {
+			receive(5)
+		}
+		if seq := r.Draw(); seq != uint64(i+1) || string(out.Pix) != string(src.Pix) {
+			t.Errorf("frame %d: sequence %d", i, seq)
+		}
+	}
+
+	sources := r.Sources()
+	if len(sources) != 1 || sources[0].Name != s.Name || sources[0].CID != s.cid || len(sources[0].Universes) != 4 {
+		t.Errorf("sources %+v", sources)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	receive(terminateCount * 4)
+	for u, st := range r.streams {
+		if st.last != (time.Time{}) {
+			t.Errorf("universe %d not terminated", u+1)
+		}
+	}
+}
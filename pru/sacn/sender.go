@@ -0,0 +1,200 @@
+package sacn
+
+import (
+	"crypto/rand"
+	"fmt"
+	"image"
+	"log"
+	"net"
+	"time"
+)
+
+// terminateCount is how many stream-terminated packets Close sends
+// for each universe, per the E1.31 standard.
+const terminateCount = 3
+
+type Sender struct {
+	// Name identifies the source to receivers.
+	Name string
+
+	// Priority is the priority of the data, up to MaxPriority.
+	Priority uint8
+
+	// StartUniverse is the universe of the first 170 pixels.
+	StartUniverse uint16
+
+	// SyncUniverse, when set, is the universe of a sync packet
+	// sent after each frame, which receivers wait for to output
+	// the universes sent before it.
+	SyncUniverse uint16
+
+	// destStr is a unicast destination, or empty to multicast.
+	destStr string
+	port    int
+	cid     [16]byte
+
+	dest map[uint16]*net.UDPAddr
+	conn *net.UDPConn
+
+	// seq is the sequence number of each universe, and of the
+	// sync packets.
+	seq     map[uint16]uint8
+	syncSeq uint8
+
+	universes     []uint16
+	lastDiscovery time.Time
+	lastLog       time.Time
+
+	buf [dataHeader + dmxChannels]byte
+}
+
+// NewSender returns a Sender to a unicast address, or to the
+// multicast group of each universe if ipAddr is empty.
+func NewSender(ipAddr string) *Sender {
+	s := &Sender{
+		Name:          "nerve",
+		Priority:      DefaultPriority,
+		StartUniverse: DefaultConfig.StartUniverse,
+		destStr:       ipAddr,
+		port:          Port,
+		dest:          map[uint16]*net.UDPAddr{},
+		seq:           map[uint16]uint8{},
+	}
+	// The CID is a random (version 4) UUID.
+	rand.Read(s.cid[:])
+	s.cid[6] = s.cid[6]&0x0f | 0x40
+	s.cid[8] = s.cid[8]&0x3f | 0x80
+	return s
+}
+
+func (s *Sender) Send(buffer *image.RGBA) error {
+	err := s.send(buffer)
+	if err != nil {
+		now := time.Now()
+		if now.Sub(s.lastLog) >= time.Second {
+			log.Printf("send: %v\n", err)
+			s.lastLog = now
+		}
+	}
+	return err
+}
+
+// addr returns the destination of a universe's packets.
+func (s *Sender) addr(universe uint16) (*net.UDPAddr, error) {
+	if a := s.dest[universe]; a != nil {
+		return a, nil
+	}
+	a := Multicast(universe)
+	if s.destStr != "" {
+		ip, err := net.ResolveIPAddr("ip4", s.destStr)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving udp: %v", err)
+		}
+		a = &net.UDPAddr{IP: ip.IP}
+	}
+	a.Port = s.port
+	s.dest[universe] = a
+	return a, nil
+}
+
+// write sends one packet, closing the connection on error.
+func (s *Sender) write(b []byte, universe uint16) error {
+	if s.conn == nil {
+		conn, err := net.ListenUDP("udp4", nil)
+		if err != nil {
+			return fmt.Errorf("error opening udp: %v", err)
+		}
+		s.conn = conn
+	}
+	dest, err := s.addr(universe)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.WriteTo(b, dest); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("error writing packet: %v", err)
+	}
+	return nil
+}
+
+func (s *Sender) send(buffer *image.RGBA) error {
+	if s.Priority > MaxPriority {
+		return fmt.Errorf("priority %d is above %d", s.Priority, MaxPriority)
+	}
+	var data [3 * maxPerPacket]byte
+	m := message{
+		source:   s.Name,
+		priority: s.Priority,
+		sync:     s.SyncUniverse,
+		universe: s.StartUniverse,
+	}
+	s.universes = s.universes[:0]
+
+	pixels := buffer.Rect.Dx() * buffer.Rect.Dy()
+	for p := 0; p < pixels; p += maxPerPacket {
+		num := maxPerPacket
+		if pixels-p < num {
+			num = pixels - p
+		}
+		for i := 0; i < num; i++ {
+			pi := 4 * (p + i)
+			data[i*3+0] = buffer.Pix[pi+0]
+			data[i*3+1] = buffer.Pix[pi+1]
+			data[i*3+2] = buffer.Pix[pi+2]
+		}
+		m.data = data[:num*3]
+		m.seq = s.seq[m.universe]
+		s.seq[m.universe]++
+
+		if err := s.write(encodeData(s.buf[:], s.cid, &m), m.universe); err != nil {
+			return err
+		}
+		s.universes = append(s.universes, m.universe)
+		m.universe++
+	}
+
+	if s.SyncUniverse != 0 {
+		b := encodeSync(s.buf[:], s.cid, s.syncSeq, s.SyncUniverse)
+		s.syncSeq++
+		if err := s.write(b, s.SyncUniverse); err != nil {
+			return err
+		}
+	}
+
+	if now := time.Now(); now.Sub(s.lastDiscovery) >= discoveryInterval {
+		s.lastDiscovery = now
+		for _, b := range encodeDiscovery(s.cid, s.Name, s.universes) {
+			if err := s.write(b, DiscoveryUniverse); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close tells receivers that the universes of the last frame will
+// not be sent again, so that they need not wait for them.
+func (s *Sender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	m := message{
+		source:   s.Name,
+		priority: s.Priority,
+		options:  optionTerminated,
+	}
+	for i := 0; i < terminateCount; i++ {
+		for _, u := range s.universes {
+			m.universe = u
+			m.seq = s.seq[u]
+			s.seq[u]++
+			if err := s.write(encodeData(s.buf[:], s.cid, &m), u); err != nil {
+				return err
+			}
+		}
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}